@@ -0,0 +1,225 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authenticator identifies the client of a request. It returns false if the
+// request carries no credentials it handles, and an error if they are invalid.
+type authenticator interface {
+	authenticate(r *http.Request) (string, bool, error)
+}
+
+// basicAuthenticator checks basic auth credentials against bcrypt hashes
+type basicAuthenticator struct {
+	hashes map[string][]byte
+	// compared against for unknown users, so they take as long as known ones
+	dummyHash []byte
+}
+
+func (a *basicAuthenticator) authenticate(r *http.Request) (string, bool, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false, nil
+	}
+	hash, exists := a.hashes[user]
+	if !exists {
+		hash = a.dummyHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !exists {
+		return "", true, fmt.Errorf("invalid password for user %q", user)
+	}
+	return user, true, nil
+}
+
+// bearerAuthenticator checks bearer tokens against static tokens
+type bearerAuthenticator struct {
+	// token name by token
+	tokens map[string]string
+}
+
+func (a *bearerAuthenticator) authenticate(r *http.Request) (string, bool, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false, nil
+	}
+	for known, name := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return name, true, nil
+		}
+	}
+	return "", true, fmt.Errorf("invalid bearer token")
+}
+
+// clientCertAuthenticator identifies clients by the common name of their
+// certificate, verified against server.tls.client_ca_file during the handshake.
+// Identities are prefixed with config.ClientCertPrefix, so a certificate
+// can't pass for a user or token of the same name.
+type clientCertAuthenticator struct{}
+
+func (a *clientCertAuthenticator) authenticate(r *http.Request) (string, bool, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false, nil
+	}
+	return config.ClientCertPrefix + r.TLS.VerifiedChains[0][0].Subject.CommonName, true, nil
+}
+
+// authRoute is the policy of requests whose path starts with Path
+type authRoute struct {
+	Path      string
+	Anonymous bool
+	Allow     map[string]bool
+}
+
+// authHandler authenticates requests and applies route policies before
+// passing them to next
+type authHandler struct {
+	next           http.Handler
+	authenticators []authenticator
+	// longest paths first
+	routes []authRoute
+	// sent along 401 responses
+	challenges []string
+}
+
+// NewAuthHandler wraps next with authentication and the route policies of
+// auth. Requests matching no route need any authenticated identity. next is
+// returned as is if auth is empty.
+func NewAuthHandler(auth config.AuthConfig, next http.Handler) (http.Handler, error) {
+	if len(auth.Users) == 0 && len(auth.Tokens) == 0 && len(auth.Routes) == 0 {
+		return next, nil
+	}
+
+	handler := &authHandler{next: next}
+	names := make(map[string]bool)
+
+	if len(auth.Users) > 0 {
+		basic := &basicAuthenticator{hashes: make(map[string][]byte)}
+		for _, user := range auth.Users {
+			if user.Name == "" || names[user.Name] || strings.HasPrefix(user.Name, config.ClientCertPrefix) {
+				return nil, fmt.Errorf("user name %q is empty, already used or reserved for client certificates", user.Name)
+			}
+			names[user.Name] = true
+
+			cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+			if err != nil {
+				return nil, fmt.Errorf("invalid password_hash of user %q: %v", user.Name, err)
+			}
+			basic.hashes[user.Name] = []byte(user.PasswordHash)
+			if basic.dummyHash == nil {
+				if basic.dummyHash, err = bcrypt.GenerateFromPassword([]byte("metricly"), cost); err != nil {
+					return nil, err
+				}
+			}
+		}
+		handler.authenticators = append(handler.authenticators, basic)
+		handler.challenges = append(handler.challenges, `Basic realm="metricly"`)
+	}
+
+	if len(auth.Tokens) > 0 {
+		bearer := &bearerAuthenticator{tokens: make(map[string]string)}
+		for _, token := range auth.Tokens {
+			if token.Name == "" || names[token.Name] || strings.HasPrefix(token.Name, config.ClientCertPrefix) {
+				return nil, fmt.Errorf("token name %q is empty, already used or reserved for client certificates", token.Name)
+			}
+			names[token.Name] = true
+
+			content, err := os.ReadFile(token.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read token %q: %v", token.Name, err)
+			}
+			value := strings.TrimSpace(string(content))
+			if value == "" {
+				return nil, fmt.Errorf("token file of %q is empty", token.Name)
+			}
+			bearer.tokens[value] = token.Name
+		}
+		handler.authenticators = append(handler.authenticators, bearer)
+		handler.challenges = append(handler.challenges, `Bearer realm="metricly"`)
+	}
+
+	// client certificates are only verified if server.tls.client_ca_file is set
+	handler.authenticators = append(handler.authenticators, &clientCertAuthenticator{})
+
+	for _, route := range auth.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("route path %q must start with /", route.Path)
+		}
+		policy := authRoute{Path: route.Path, Anonymous: route.Anonymous}
+		if len(route.Allow) > 0 {
+			policy.Allow = make(map[string]bool)
+			for _, name := range route.Allow {
+				policy.Allow[name] = true
+			}
+		}
+		handler.routes = append(handler.routes, policy)
+	}
+	sort.SliceStable(handler.routes, func(i, j int) bool {
+		return len(handler.routes[i].Path) > len(handler.routes[j].Path)
+	})
+	return handler, nil
+}
+
+// route returns the policy of a path
+func (h *authHandler) route(path string) authRoute {
+	for _, route := range h.routes {
+		if strings.HasPrefix(path, route.Path) {
+			return route
+		}
+	}
+	return authRoute{}
+}
+
+// identify returns the identity of the client, empty for anonymous ones.
+// Credentials of the Authorization header take precedence over client
+// certificates.
+func (h *authHandler) identify(r *http.Request) (string, error) {
+	for _, auth := range h.authenticators {
+		identity, found, err := auth.authenticate(r)
+		if found {
+			return identity, err
+		}
+	}
+	return "", nil
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := h.route(r.URL.Path)
+
+	identity, err := h.identify(r)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("%s %s %s: %v", r.RemoteAddr, r.Method, r.URL.Path, err))
+		h.unauthorized(w)
+		return
+	}
+
+	switch {
+	case route.Anonymous:
+	case identity == "":
+		h.unauthorized(w)
+		return
+	case route.Allow != nil && !route.Allow[identity]:
+		slog.Warn(fmt.Sprintf("%s %s %s: %q is not allowed", r.RemoteAddr, r.Method, r.URL.Path, identity))
+		sendErrorResponse(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	h.next.ServeHTTP(w, r)
+}
+
+// unauthorized asks the client for credentials
+func (h *authHandler) unauthorized(w http.ResponseWriter) {
+	for _, challenge := range h.challenges {
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	sendErrorResponse(w, http.StatusUnauthorized, "unauthorized")
+}
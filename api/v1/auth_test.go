@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"metricly/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestAuthHandler(t *testing.T) http.Handler {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(t.TempDir(), "grafana")
+	if err := os.WriteFile(tokenFile, []byte("grafana-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := NewAuthHandler(config.AuthConfig{
+		Users:  []config.AuthUserConfig{{Name: "alice", PasswordHash: string(hash)}},
+		Tokens: []config.AuthTokenConfig{{Name: "grafana", TokenFile: tokenFile}},
+		Routes: []config.AuthRouteConfig{
+			{Path: "/api/v1/metrics", Allow: []string{"cert:prometheus"}},
+			{Path: "/api/v1/", Allow: []string{"alice", "grafana"}},
+			{Path: "/", Anonymous: true},
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return handler
+}
+
+// withClientCert marks the request as sent with a verified client certificate
+func withClientCert(r *http.Request, commonName string) {
+	r.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	handler := newTestAuthHandler(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		setup  func(r *http.Request)
+		status int
+	}{
+		{"anonymous index", "/", func(r *http.Request) {}, http.StatusOK},
+		{"anonymous query", "/api/v1/query", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"basic auth query", "/api/v1/query", func(r *http.Request) { r.SetBasicAuth("alice", "s3cret") }, http.StatusOK},
+		{"wrong password", "/api/v1/query", func(r *http.Request) { r.SetBasicAuth("alice", "guess") }, http.StatusUnauthorized},
+		{"unknown user", "/api/v1/query", func(r *http.Request) { r.SetBasicAuth("mallory", "s3cret") }, http.StatusUnauthorized},
+		{"token range query", "/api/v1/query_range", func(r *http.Request) { r.Header.Set("Authorization", "Bearer grafana-token") }, http.StatusOK},
+		{"wrong token", "/api/v1/query_range", func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"scraper metrics", "/api/v1/metrics", func(r *http.Request) { withClientCert(r, "prometheus") }, http.StatusOK},
+		{"scraper query", "/api/v1/aggregate", func(r *http.Request) { withClientCert(r, "prometheus") }, http.StatusForbidden},
+		{"user metrics", "/api/v1/metrics", func(r *http.Request) { r.SetBasicAuth("alice", "s3cret") }, http.StatusForbidden},
+		// certificate identities don't share the names of users and tokens
+		{"certificate named as user", "/api/v1/query", func(r *http.Request) { withClientCert(r, "alice") }, http.StatusForbidden},
+		{
+			"header before certificate", "/api/v1/query", func(r *http.Request) {
+				withClientCert(r, "prometheus")
+				r.SetBasicAuth("alice", "s3cret")
+			}, http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		test.setup(request)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, recorder.Code)
+		}
+		if recorder.Code == http.StatusUnauthorized && len(recorder.Header().Values("WWW-Authenticate")) != 2 {
+			t.Errorf("%s: expected basic and bearer challenges, got %v", test.name, recorder.Header().Values("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAuthHandlerConfig(t *testing.T) {
+	next := http.NotFoundHandler()
+	if handler, err := NewAuthHandler(config.AuthConfig{}, next); err != nil || handler == nil {
+		t.Errorf("expected empty auth to leave the handler open, got %v", err)
+	}
+
+	for name, auth := range map[string]config.AuthConfig{
+		"invalid hash":  {Users: []config.AuthUserConfig{{Name: "alice", PasswordHash: "s3cret"}}},
+		"missing token": {Tokens: []config.AuthTokenConfig{{Name: "grafana", TokenFile: filepath.Join(t.TempDir(), "missing")}}},
+		"relative path": {Routes: []config.AuthRouteConfig{{Path: "api/v1/query"}}},
+		"reserved name": {Tokens: []config.AuthTokenConfig{{Name: "cert:prometheus", TokenFile: "/dev/null"}}},
+	} {
+		if _, err := NewAuthHandler(auth, next); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
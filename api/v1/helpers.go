@@ -71,15 +71,6 @@ func QueryPrometheus[T any](queryURL string, target *T) error {
 
 }
 
-// log API requests
-func logAPIRequests(r *http.Request, duration int64, statusCode int) {
-	slog.Info(
-		fmt.Sprintf(
-			"%s %s %s status: %d len: %d time: %dms", r.RemoteAddr, r.Method, r.URL, statusCode, r.ContentLength, duration,
-		),
-	)
-}
-
 func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 
 	error := ErrorResponse{
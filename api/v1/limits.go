@@ -0,0 +1,190 @@
+package v1
+
+import (
+	"fmt"
+	"math"
+	"metricly/config"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxQueueWait   = 10 * time.Second
+	defaultMaxRangePoints = 11000
+
+	// idle clients are forgotten once their bucket is full again, checked
+	// this often
+	sweepInterval = time.Minute
+)
+
+// tokenBucket holds the tokens left to a client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter allows requests per client address at a sustained rate, with
+// bursts up to burst requests
+type rateLimiter struct {
+	mutex     sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token of the client, or returns how long until one is
+// available
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		refill := time.Duration(l.burst / l.rate * float64(time.Second))
+		for key, bucket := range l.buckets {
+			if now.Sub(bucket.last) > refill {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, exists := l.buckets[client]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// clientAddress identifies clients by IP, clients behind a proxy share it
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// sendTooManyRequests answers 429, telling the client when to retry
+func sendTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	sendErrorResponse(w, http.StatusTooManyRequests, message)
+}
+
+// NewQueryLimiter returns the middleware applying limits to the endpoints
+// proxying queries to Prometheus. It holds the rate buckets and concurrency
+// slots, so it should outlive handlers rebuilt with unchanged limits.
+func NewQueryLimiter(limits config.LimitsConfig) Middleware {
+	var rate *rateLimiter
+	if limits.RequestsPerSecond > 0 {
+		rate = newRateLimiter(limits.RequestsPerSecond, limits.Burst)
+	}
+
+	var slots chan struct{}
+	maxQueueWait := limits.MaxQueueWait
+	if limits.MaxConcurrentQueries > 0 {
+		slots = make(chan struct{}, limits.MaxConcurrentQueries)
+		if maxQueueWait <= 0 {
+			maxQueueWait = defaultMaxQueueWait
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rate != nil {
+				if allowed, retryAfter := rate.allow(clientAddress(r), time.Now()); !allowed {
+					sendTooManyRequests(w, retryAfter, "rate limit exceeded")
+					return
+				}
+			}
+
+			if slots != nil {
+				timer := time.NewTimer(maxQueueWait)
+				defer timer.Stop()
+
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-timer.C:
+					sendTooManyRequests(w, maxQueueWait, fmt.Sprintf("too many concurrent queries, waited %s", maxQueueWait))
+					return
+				case <-r.Context().Done():
+					// client is gone
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseTimestamp parses an RFC3339 or unix timestamp, both accepted by
+// Prometheus
+func parseTimestamp(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// parseStep parses a duration or a number of seconds, both accepted by
+// Prometheus
+func parseStep(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// checkRangePoints refuses ranges returning more points per series than
+// maxPoints, which would make Prometheus evaluate the query that many times
+func checkRangePoints(start, end, step string, maxPoints int) error {
+	startTime, err := parseTimestamp(start)
+	if err != nil {
+		return fmt.Errorf("invalid start %s", start)
+	}
+	endTime, err := parseTimestamp(end)
+	if err != nil {
+		return fmt.Errorf("invalid end %s", end)
+	}
+	stepDuration, err := parseStep(step)
+	if err != nil || stepDuration <= 0 {
+		return fmt.Errorf("invalid step %s, must be a positive duration", step)
+	}
+	if endTime.Before(startTime) {
+		return fmt.Errorf("end must not be before start")
+	}
+
+	if points := int64(endTime.Sub(startTime)/stepDuration) + 1; points > int64(maxPoints) {
+		return fmt.Errorf("range of %s with step %s returns %d points per series, more than %d, increase step", endTime.Sub(startTime), stepDuration, points, maxPoints)
+	}
+	return nil
+}
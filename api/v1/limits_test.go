@@ -0,0 +1,110 @@
+package v1
+
+import (
+	"encoding/json"
+	"metricly/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.allow("10.0.0.1", now); !allowed {
+			t.Fatalf("expected burst request %d to be allowed", i)
+		}
+	}
+	allowed, retryAfter := limiter.allow("10.0.0.1", now)
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Errorf("expected request over burst to wait 500ms, got %v %s", allowed, retryAfter)
+	}
+	if allowed, _ := limiter.allow("10.0.0.2", now); !allowed {
+		t.Errorf("expected other clients to have their own bucket")
+	}
+	if allowed, _ := limiter.allow("10.0.0.1", now.Add(500*time.Millisecond)); !allowed {
+		t.Errorf("expected a token to be refilled after 500ms")
+	}
+
+	// full buckets of idle clients are dropped
+	limiter.allow("10.0.0.2", now.Add(2*sweepInterval))
+	if _, exists := limiter.buckets["10.0.0.1"]; exists {
+		t.Errorf("expected idle client to be forgotten")
+	}
+}
+
+func TestQueryLimiter(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	limit := NewQueryLimiter(config.LimitsConfig{MaxConcurrentQueries: 1, MaxQueueWait: 50 * time.Millisecond})
+	handler := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+		close(done)
+	}()
+	<-started
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected queued query to time out with 429 and Retry-After, got %d %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.Data.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected error response format, got %+v %v", response, err)
+	}
+
+	close(release)
+	<-done
+
+	// the slot is free again
+	go func() { <-started }()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected query to run once the slot is released, got %d", recorder.Code)
+	}
+
+	limit = NewQueryLimiter(config.LimitsConfig{RequestsPerSecond: 0.1})
+	handler = limit(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "10" {
+		t.Errorf("expected rate limited query to get 429 with Retry-After 10, got %d %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+}
+
+func TestProcessRangeParamsLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		valid  bool
+	}{
+		{"default step", map[string]string{"last": "1h"}, true},
+		{"long range default step", map[string]string{"last": "720h"}, false},
+		{"long range coarse step", map[string]string{"last": "720h", "step": "5m"}, true},
+		{"rfc3339 range", map[string]string{"start": "2024-11-21T09:18:00Z", "end": "2024-11-21T10:18:00Z", "step": "1"}, true},
+		{"unix range", map[string]string{"start": "1732180680", "end": "1732784680", "step": "15s"}, false},
+		{"zero step", map[string]string{"last": "1h", "step": "0s"}, false},
+		{"reversed range", map[string]string{"start": "1732784680", "end": "1732180680"}, false},
+	}
+
+	for _, test := range tests {
+		_, err := processRangeParams(test.params, 0)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
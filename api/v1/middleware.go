@@ -0,0 +1,152 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"metricly/pkg/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Middleware wraps a handler with behaviour shared by every route
+type Middleware func(http.Handler) http.Handler
+
+type requestIDKey struct{}
+
+const requestIDHeader = "X-Request-Id"
+
+var (
+	// request IDs sent by clients are kept if they look sane
+	validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	registerOnce sync.Once
+)
+
+// Chain wraps handler with middlewares, the first one being the outermost.
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// RequestID assigns an ID to every request, sent back in X-Request-Id. An ID
+// sent by the client, e.g. a proxy, is kept.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID returns a random 128 bits ID
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// RequestIDFromContext returns the ID assigned by RequestID, empty if none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusRecorder captures the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(content []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(content)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// registerHTTPMetrics registers request metrics on the default registry,
+// served along pollster metrics
+func registerHTTPMetrics() {
+	constLabels := prometheus.Labels{"hostname": common.GetHostname()}
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "metricly_http_requests_total",
+		Help:        "Requests served by metricly",
+		ConstLabels: constLabels,
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "metricly_http_request_duration_seconds",
+		Help:        "Time taken to serve requests",
+		ConstLabels: constLabels,
+		Buckets:     prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	prometheus.MustRegister(httpRequests, httpDuration)
+}
+
+// Instrument logs every request along with its response, and records request
+// metrics per route.
+func Instrument(next http.Handler) http.Handler {
+	registerOnce.Do(registerHTTPMetrics)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		if rec.status == 0 {
+			// nothing written, net/http answers 200
+			rec.status = http.StatusOK
+		}
+		// set by the ServeMux which routed the request, bounding the label
+		// values to registered routes unlike the path
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(duration.Seconds())
+
+		slog.Info("request served",
+			"request_id", RequestIDFromContext(r.Context()),
+			"remote_addr", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", duration.Milliseconds(),
+		)
+	})
+}
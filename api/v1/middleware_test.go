@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		if RequestIDFromContext(r.Context()) == "" {
+			t.Errorf("expected request ID in context")
+		}
+		sendErrorResponse(w, http.StatusBadRequest, "parameter metric required")
+	})
+	mux.HandleFunc("/api/v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metricly_cpu_total 1\n"))
+	})
+	handler := Chain(mux, RequestID, Instrument)
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("/api/v1/query", http.MethodGet, "400"))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", recorder.Code)
+	}
+	if len(recorder.Header().Get("X-Request-Id")) != 32 {
+		t.Errorf("expected a generated request ID, got %q", recorder.Header().Get("X-Request-Id"))
+	}
+	if after := testutil.ToFloat64(httpRequests.WithLabelValues("/api/v1/query", http.MethodGet, "400")); after != before+1 {
+		t.Errorf("expected request to be counted with its real status, got %v", after-before)
+	}
+
+	// IDs set by clients are kept, unless they could garble logs
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/metrics?x=1", nil)
+	request.Header.Set("X-Request-Id", "proxy-42")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Header().Get("X-Request-Id") != "proxy-42" {
+		t.Errorf("expected client request ID to be kept, got %q", recorder.Header().Get("X-Request-Id"))
+	}
+	if testutil.ToFloat64(httpRequests.WithLabelValues("/api/v1/metrics", http.MethodGet, "200")) == 0 {
+		t.Errorf("expected metrics request to be counted")
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil)
+	request.Header.Set("X-Request-Id", "bad id\nforged log line")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if id := recorder.Header().Get("X-Request-Id"); len(id) != 32 {
+		t.Errorf("expected invalid request ID to be replaced, got %q", id)
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Write([]byte("hello"))
+	rec.WriteHeader(http.StatusInternalServerError)
+	rec.Write([]byte(" world"))
+
+	if rec.status != http.StatusOK || rec.bytes != 11 {
+		t.Errorf("expected implicit 200 and 11 bytes, got %d %d", rec.status, rec.bytes)
+	}
+}
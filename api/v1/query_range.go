@@ -36,7 +36,7 @@ func prometheusQueryRangeHandler(conf *config.Config) http.HandlerFunc {
 			return
 		}
 
-		queryParams, err = processRangeParams(queryParams)
+		queryParams, err = processRangeParams(queryParams, conf.Server.Limits.MaxRangePoints)
 		if err != nil {
 			sendErrorResponse(w, http.StatusBadRequest, err.Error())
 			return
@@ -62,7 +62,7 @@ func prometheusQueryRangeHandler(conf *config.Config) http.HandlerFunc {
 	}
 }
 
-func processRangeParams(requestParams map[string]string) (map[string]string, error) {
+func processRangeParams(requestParams map[string]string, maxPoints int) (map[string]string, error) {
 
 	if requestParams["last"] != "" {
 		if requestParams["start"] != "" || requestParams["end"] != "" {
@@ -87,6 +87,13 @@ func processRangeParams(requestParams map[string]string) (map[string]string, err
 		requestParams["step"] = "15s"
 	}
 
+	if maxPoints <= 0 {
+		maxPoints = defaultMaxRangePoints
+	}
+	if err := checkRangePoints(requestParams["start"], requestParams["end"], requestParams["step"], maxPoints); err != nil {
+		return nil, err
+	}
+
 	return requestParams, nil
 
 }
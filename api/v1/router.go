@@ -8,7 +8,9 @@ import (
 	"log/slog"
 )
 
-func HandleRoutes(mux *http.ServeMux, conf *config.Config) {
+// HandleRoutes registers the API, query endpoints share the limit middleware
+// protecting Prometheus
+func HandleRoutes(mux *http.ServeMux, conf *config.Config, limit Middleware) {
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(
 			`<html>
@@ -25,9 +27,9 @@ func HandleRoutes(mux *http.ServeMux, conf *config.Config) {
 
 	mux.Handle("/api/v1/metrics", MetricsHandler(conf))
 
-	mux.HandleFunc("/api/v1/query", PrometheusQueryHandler(conf))
+	mux.Handle("/api/v1/query", limit(PrometheusQueryHandler(conf)))
 
-	mux.HandleFunc("/api/v1/query_range", prometheusQueryRangeHandler(conf))
+	mux.Handle("/api/v1/query_range", limit(prometheusQueryRangeHandler(conf)))
 
-	mux.HandleFunc("/api/v1/aggregate", PrometheusAggregateHandler(conf))
+	mux.Handle("/api/v1/aggregate", limit(PrometheusAggregateHandler(conf)))
 }
@@ -8,17 +8,39 @@ import (
 	"metricly/config"
 	collector "metricly/internal/collector"
 	"metricly/internal/server"
+	"os"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
-	// Load configuration
+	if len(os.Args) > 1 && os.Args[1] == "check-config" {
+		os.Exit(checkConfig(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if len(os.Args) > 2 && os.Args[2] == "dump" {
+			os.Exit(dumpConfig(os.Args[3:]))
+		}
+		fmt.Fprintf(os.Stderr, "Usage: %s config dump [-config] [file] [flags]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	// Load configuration, any field can be overridden by flags
 	configPath := flag.String("config", "", "configuration file path")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = usage
 	flag.Parse()
+	if flag.NArg() > 0 {
+		// a mistyped subcommand mustn't start the server
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
 	config, err := config.LoadConfig(configPath)
 	if err != nil {
 		slog.Error(fmt.Sprintf("Error loading config file %v", err))
+		os.Exit(server.ExitFailure)
 	}
 
 	if config.Debug {
@@ -33,9 +55,84 @@ func main() {
 	defer cancel()
 
 	// Start metrics collection before starting server
-	server.StartMetricsCollection(ctx, config.CollectionInterval, cc)
+	pollsters := server.StartMetricsCollection(ctx, config, cc)
 
-	// Start metricly metrics hosting server
-	server.StartMetriclyServer(ctx, config)
+	// Reloads restart pollsters and rebuild routes with the new config
+	reloader, err := server.NewReloader(ctx, *configPath, config, cc, pollsters)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(server.ExitFailure)
+	}
 
+	// Serve metrics until a signal or a failed listener, then stop pollsters
+	code := server.Run(ctx, reloader)
+	cancel()
+	os.Exit(code)
+}
+
+// usage lists the subcommands besides the flags of the server
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  %[1]s [-config file] [flags]          serve metrics
+  %[1]s check-config [file] [flags]     validate a config file
+  %[1]s config dump [file] [flags]      print the effective configuration
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// loadConfigCommand loads the configuration of a subcommand taking the same
+// flags as metricly, the file may also be given as argument
+func loadConfigCommand(name string, args []string) (*config.Config, string, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := flags.String("config", "", "configuration file path")
+	config.RegisterFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [-config] [file] [flags]\n", os.Args[0], name)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		*configPath = flags.Arg(0)
+		flags.Parse(flags.Args()[1:])
+	}
+
+	// only errors are of interest
+	slog.SetLogLoggerLevel(slog.LevelWarn)
+	conf, err := config.LoadConfig(configPath)
+	return conf, config.Path(*configPath), err
+}
+
+// checkConfig validates a config file without starting metricly, e.g. in CI,
+// returning the exit code
+func checkConfig(args []string) int {
+	_, path, err := loadConfigCommand("check-config", args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
+
+// dumpConfig prints the configuration merged from defaults, file,
+// environment and flags, with secrets redacted
+func dumpConfig(args []string) int {
+	conf, _, err := loadConfigCommand("config dump", args)
+	if err == nil {
+		conf, err = conf.Redacted()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(conf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
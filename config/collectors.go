@@ -0,0 +1,141 @@
+package config
+
+import "time"
+
+// Collectors holds settings of pollsters that need more than a source path
+type Collectors struct {
+	Textfile     TextfileConfig     `yaml:"textfile"`
+	Scripts      []ScriptConfig     `yaml:"scripts"`
+	FileScrape   []FileScrapeConfig `yaml:"file_scrape"`
+	Logtail      LogtailConfig      `yaml:"logtail"`
+	Probes       []ProbeConfig      `yaml:"probes"`
+	Certificates CertificatesConfig `yaml:"certificates"`
+	Systemd      SystemdConfig      `yaml:"systemd"`
+	Containers   ContainersConfig   `yaml:"containers"`
+	Kubernetes   KubernetesConfig   `yaml:"kubernetes"`
+}
+
+// TextfileConfig configures the textfile pollster, disabled if Directory is empty
+type TextfileConfig struct {
+	Directory string `yaml:"directory"`
+}
+
+// ScriptConfig configures a command run periodically by the script pollster,
+// whose stdout is parsed into metrics
+type ScriptConfig struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+	// defaults to the global collection interval
+	Interval time.Duration `yaml:"interval"`
+	// defaults to the script interval
+	Timeout        time.Duration     `yaml:"timeout"`
+	Env            map[string]string `yaml:"env" secret:"true"`
+	WorkingDir     string            `yaml:"working_dir"`
+	MaxOutputBytes int               `yaml:"max_output_bytes"`
+	// "prometheus" (default) for the text exposition format or "json" for
+	// an object of key/value pairs
+	Format string `yaml:"format"`
+}
+
+// FileScrapeConfig declares a metric read out of /proc or /sys files. Every
+// line of the files matching Path is matched against Regex, whose named group
+// "value" holds the value while other named groups become labels.
+type FileScrapeConfig struct {
+	Name string `yaml:"name"`
+	// glob, matched paths are reported in a "path" label
+	Path  string `yaml:"path"`
+	Regex string `yaml:"regex"`
+	// "gauge" (default) or "counter"
+	Type string `yaml:"type"`
+	// appended to the metric name, e.g. "bytes"
+	Unit string `yaml:"unit"`
+	Help string `yaml:"help"`
+	// multiplies every value, e.g. 1024 for kB, defaults to 1
+	Scale float64 `yaml:"scale"`
+}
+
+// LogtailConfig configures the logtail pollster following log files
+type LogtailConfig struct {
+	// read offsets are saved there so lines aren't counted twice across
+	// restarts, offsets are kept in memory only if empty
+	StateFile string          `yaml:"state_file"`
+	Files     []LogFileConfig `yaml:"files"`
+}
+
+// LogFileConfig lists the rules applied to every new line of a log file
+type LogFileConfig struct {
+	Path  string          `yaml:"path"`
+	Rules []LogRuleConfig `yaml:"rules"`
+}
+
+// LogRuleConfig derives a metric from lines matching Regex. Named groups
+// become labels except "value", which a counter is incremented by (1 when
+// absent) and a histogram observes.
+type LogRuleConfig struct {
+	Name  string `yaml:"name"`
+	Regex string `yaml:"regex"`
+	// "counter" (default) or "histogram"
+	Type string `yaml:"type"`
+	Help string `yaml:"help"`
+	// histogram buckets, defaults to the Prometheus default buckets
+	Buckets []float64 `yaml:"buckets"`
+}
+
+// ProbeConfig configures a target checked periodically by the probe pollster
+type ProbeConfig struct {
+	Name string `yaml:"name"`
+	// "http", "tcp" or "tls"
+	Type string `yaml:"type"`
+	// an URL for http probes, host:port otherwise
+	Target string `yaml:"target"`
+	// defaults to the global collection interval
+	Interval time.Duration `yaml:"interval"`
+	// defaults to the probe interval
+	Timeout time.Duration `yaml:"timeout"`
+	// http only, any 2xx status is accepted if empty
+	ExpectedStatus []int `yaml:"expected_status"`
+	// http only, the probe fails unless the body matches
+	BodyRegex string            `yaml:"body_regex"`
+	Headers   map[string]string `yaml:"headers" secret:"true"`
+	// http and tls, defaults to the host of the target
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// CertificatesConfig configures the certificate file pollster, disabled if
+// Paths is empty
+type CertificatesConfig struct {
+	// files or globs of PEM, DER and PKCS#12 (*.p12, *.pfx) files
+	Paths []string `yaml:"paths"`
+	// password of PKCS#12 keystores, empty by default
+	KeystorePassword string `yaml:"keystore_password" secret:"true"`
+}
+
+// SystemdConfig configures the systemd pollster reading unit states over
+// D-Bus. Unit names must fully match UnitInclude and not match UnitExclude.
+type SystemdConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// defaults to every unit
+	UnitInclude string `yaml:"unit_include"`
+	UnitExclude string `yaml:"unit_exclude"`
+}
+
+// ContainersConfig configures the container pollster querying the Podman
+// API socket
+type ContainersConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// KubernetesConfig configures the pod resolver querying the kubelet, used to
+// label cgroup metrics with pod, namespace and container names
+type KubernetesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// defaults to https://127.0.0.1:10250
+	KubeletURL string `yaml:"kubelet_url"`
+	// defaults to the service account token and CA
+	TokenFile          string `yaml:"token_file"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// how long the pod list is kept, defaults to 1m
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
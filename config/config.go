@@ -5,18 +5,101 @@ server:
 
 	address: 127.0.0.1
 	port: 8080
+	listen:
+	  - address: 127.0.0.1:8080
+	  - unix: /run/metricly/metricly.sock
+	    mode: "0660"
+	    group: nginx
+	tls:
+	  cert_file: /etc/metricly/tls/tls.crt
+	  key_file: /etc/metricly/tls/tls.key
+	  client_ca_file: /etc/metricly/tls/ca.crt
+	  require_client_cert: true
+	  min_version: "1.3"
+	auth:
+	  users:
+	    - name: alice
+	      password_hash: $2y$10$2b2cU8CPhOTaGrs1HRQuAueS7JTT5ZHsHSzYiFPm1leZck7Mc8T4W
+	  tokens:
+	    - name: grafana
+	      token_file: /etc/metricly/tokens/grafana
+	  routes:
+	    - path: /api/v1/metrics
+	      allow: [prometheus]
+	    - path: /api/v1/
+	      allow: [alice, grafana]
+	limits:
+	  requests_per_second: 2
+	  burst: 10
+	  max_concurrent_queries: 4
+	  max_queue_wait: 5s
+	reload:
+	  endpoint: true
+	  watch_interval: 30s
+	shutdown_timeout: 10s
 
 prometheus:
 
 	address: 127.0.0.1
 	port: 9090
 
-interval: 10
+interval: 10s
+
+collectors:
+
+	textfile:
+	  directory: /var/lib/metricly/textfile
+	scripts:
+	  - name: raid_health
+	    command: ["/usr/local/bin/check_raid.sh"]
+	    interval: 1m
+	    timeout: 10s
+	file_scrape:
+	  - name: pressure_cpu_stalled
+	    path: /proc/pressure/cpu
+	    regex: '^some .*total=(?P<value>[0-9]+)$'
+	    type: counter
+	    unit: seconds
+	    scale: 0.000001
+	logtail:
+	  state_file: /var/lib/metricly/logtail.json
+	  files:
+	    - path: /var/log/nginx/access.log
+	      rules:
+	        - name: nginx_server_errors
+	          regex: '^(?P<vhost>\S+) .* (?P<status>5[0-9]{2}) '
+	probes:
+	  - name: local_api
+	    type: http
+	    target: http://127.0.0.1:8080/healthz
+	    body_regex: ok
+	certificates:
+	  paths:
+	    - /etc/kubernetes/pki/*.crt
+	    - /var/lib/kubelet/pki/kubelet-client-current.pem
+	systemd:
+	  enabled: true
+	  unit_include: '.+\.(service|timer)'
+	  unit_exclude: 'user@.+\.service'
+	containers:
+	  enabled: true
+	kubernetes:
+	  enabled: true
+	  kubelet_url: https://10.0.0.12:10250
+	  insecure_skip_verify: true
+
+Every field can also be set by a flag named after its path, e.g.
+-server.port or -collectors.systemd.enabled, and by an environment variable
+prefixed with METRICLY_, e.g. METRICLY_SERVER_PORT. Flags take precedence
+over environment variables, which take precedence over the file, itself
+taking precedence over defaults.
 */
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -31,8 +114,16 @@ var (
 
 type Config struct {
 	Server struct {
-		Address string `yaml:"address"`
-		Port    string `yaml:"port"`
+		Address string          `yaml:"address"`
+		Port    string          `yaml:"port"`
+		Listen  []ListenConfig  `yaml:"listen"`
+		TLS     ServerTLSConfig `yaml:"tls"`
+		Auth    AuthConfig      `yaml:"auth"`
+		Limits  LimitsConfig    `yaml:"limits"`
+		Reload  ReloadConfig    `yaml:"reload"`
+		// in-flight requests and collections are waited for this long on
+		// shutdown, defaults to 10s
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 	} `yaml:"server"`
 	Prometheus struct {
 		Address string `yaml:"address"`
@@ -40,29 +131,41 @@ type Config struct {
 	} `yaml:"prometheus"`
 	CollectionInterval time.Duration `yaml:"interval"`
 	Debug              bool          `yaml:"debug"`
+	Collectors         Collectors    `yaml:"collectors"`
 }
 
-func LoadConfig(configPath *string) (*Config, error) {
-	if *configPath == "" {
-		// if config file is not passed in cli, parse configs from configPathDefault
-		configPath = &configPathDefault
+// Path returns the config file loaded for configPath, the default location
+// if empty
+func Path(configPath string) string {
+	if configPath == "" {
+		return configPathDefault
 	}
+	return configPath
+}
+
+func LoadConfig(configPath *string) (*Config, error) {
+	// if config file is not passed in cli, parse configs from configPathDefault
+	path := Path(*configPath)
+	configPath = &path
 
 	// attempt to load config
 	conf, err := os.Open(*configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open config file from default location: %s", *configPath)
+		return nil, fmt.Errorf("failed to open config file %s: %v", *configPath, err)
 	}
 	defer conf.Close()
 
-	var cfg Config
+	// fields missing from the file keep their default, unknown fields are
+	// most likely typos and refused
+	cfg := defaultConfig()
 	decoder := yaml.NewDecoder(conf)
-	if err := decoder.Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file %v", err)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", *configPath, err)
 	}
-	slog.Info(fmt.Sprintf("Config loaded successfully from %s", *configPath))
 
-	// checking if any variable was overrided through environment variables
+	// checking if any variable was overrided through environment variables,
+	// these predate METRICLY_ variables which take precedence
 	if env := os.Getenv("SERVER_ADDRESS"); env != "" {
 		cfg.Server.Address = env
 	}
@@ -90,6 +193,14 @@ func LoadConfig(configPath *string) (*Config, error) {
 		}
 	}
 
+	if err := cfg.applyOverrides(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s:\n%w", *configPath, err)
+	}
+	slog.Info(fmt.Sprintf("Config loaded successfully from %s", *configPath))
 	return &cfg, nil
 }
 
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	path := writeConfig(t, "prometheus:\n  address: prometheus-service\n  port: 9090\n")
+	cfg, err := LoadConfig(&path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Address != "0.0.0.0" || cfg.Server.Port != "8080" || cfg.CollectionInterval != 10*time.Second {
+		t.Errorf("expected defaults for missing fields, got %s:%s every %s", cfg.Server.Address, cfg.Server.Port, cfg.CollectionInterval)
+	}
+
+	// an empty file only holds defaults
+	path = writeConfig(t, "")
+	if _, err := LoadConfig(&path); err != nil {
+		t.Errorf("expected empty file to be valid, got %v", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := LoadConfig(&missing); err == nil {
+		t.Errorf("expected missing file to be an error")
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	path := writeConfig(t, "server:\n  prot: 8080\n")
+	_, err := LoadConfig(&path)
+	if err == nil || !strings.Contains(err.Error(), "line 2: field prot not found") {
+		t.Errorf("expected unknown field to be refused with its line, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  port: 80a
+  listen:
+    - unix: /run/metricly/metricly.sock
+      mode: "999"
+    - address: 127.0.0.1:8080
+      group: nginx
+  tls:
+    cert_file: /etc/metricly/tls/tls.crt
+    require_client_cert: true
+  auth:
+    users:
+      - name: alice
+        password_hash: plain
+    routes:
+      - path: api/v1/
+  shutdown_timeout: 0s
+interval: 0s
+collectors:
+  logtail:
+    files:
+      - path: /var/log/nginx/access.log
+        rules:
+          - name: nginx_errors
+            regex: '(5[0-9]{2}'
+  scripts:
+    - name: raid_health
+      command: [/usr/local/bin/check_raid.sh]
+      interval: 10ms
+    - name: raid_health
+      command: [/usr/local/bin/check_raid_v2.sh]
+  probes:
+    - name: api
+      type: http
+      target: https://api.example.com/health
+      timeout: 500ms
+`)
+	_, err := LoadConfig(&path)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	expected := []string{
+		"server.port: ",
+		"server.listen[0].mode: ",
+		"server.listen[1]: mode, owner and group only apply to unix sockets",
+		"server.tls: cert_file and key_file must be set together",
+		"server.tls.require_client_cert: needs client_ca_file",
+		"server.auth.users[0].password_hash: ",
+		"server.auth.routes[0].path: ",
+		"server.shutdown_timeout: ",
+		"interval: ",
+		"collectors.logtail.files[0].rules[0].regex: ",
+		"collectors.scripts[0].interval: ",
+		"collectors.scripts[1].name: ",
+		"collectors.probes[0].timeout: ",
+	}
+	if len(validationErr.Fields) != len(expected) {
+		t.Errorf("expected %d errors, got %q", len(expected), validationErr.Fields)
+	}
+	for _, prefix := range expected {
+		found := false
+		for _, field := range validationErr.Fields {
+			if strings.HasPrefix(field, prefix) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected an error starting with %q, got %q", prefix, validationErr.Fields)
+		}
+	}
+
+	// overrides are validated too
+	t.Setenv("COLLECTION_INTERVAL", "0s")
+	path = writeConfig(t, "")
+	if _, err := LoadConfig(&path); err == nil {
+		t.Errorf("expected zero COLLECTION_INTERVAL to be refused")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	flags := flag.NewFlagSet("metricly", flag.ContinueOnError)
+	RegisterFlags(flags)
+	t.Cleanup(func() { flagOverrides = make(map[string]string) })
+	if err := flags.Parse([]string{"-server.port", "9100", "-collectors.systemd.enabled", "-server.listen", `[{address: "127.0.0.1:9101"}]`}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SERVER_PORT", "9000")
+	t.Setenv("METRICLY_SERVER_PORT", "9001")
+	t.Setenv("SERVER_ADDRESS", "127.0.0.1")
+	t.Setenv("METRICLY_SERVER_ADDRESS", "127.0.0.2")
+	t.Setenv("METRICLY_INTERVAL", "30s")
+	t.Setenv("METRICLY_COLLECTORS_CERTIFICATES_PATHS", "/etc/ssl/a.crt,/etc/ssl/b.crt")
+	t.Setenv("METRICLY_COLLECTORS_SYSTEMD_UNIT_INCLUDE", `.+\.service`)
+
+	path := writeConfig(t, "server:\n  port: 8081\ninterval: 5s\ncollectors:\n  systemd:\n    unit_include: ssh.service\n")
+	cfg, err := LoadConfig(&path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// flags, then METRICLY_ variables, then legacy variables, then the file
+	if cfg.Server.Port != "9100" || cfg.Server.Address != "127.0.0.2" {
+		t.Errorf("expected flags and METRICLY_ variables to take precedence, got %s:%s", cfg.Server.Address, cfg.Server.Port)
+	}
+	if cfg.CollectionInterval != 30*time.Second || !cfg.Collectors.Systemd.Enabled || cfg.Collectors.Systemd.UnitInclude != `.+\.service` {
+		t.Errorf("expected nested fields to be overridden, got %+v every %s", cfg.Collectors.Systemd, cfg.CollectionInterval)
+	}
+	if len(cfg.Collectors.Certificates.Paths) != 2 || len(cfg.Server.Listen) != 1 || cfg.Server.Listen[0].Address != "127.0.0.1:9101" {
+		t.Errorf("expected lists to be overridden, got %v %v", cfg.Collectors.Certificates.Paths, cfg.Server.Listen)
+	}
+
+	t.Setenv("METRICLY_DEBUG", "maybe")
+	if _, err := LoadConfig(&path); err == nil || !strings.Contains(err.Error(), "METRICLY_DEBUG") {
+		t.Errorf("expected invalid variable to be named, got %v", err)
+	}
+
+	// every field gets its own variable
+	names := make(map[string]bool)
+	for _, f := range fields("", reflect.ValueOf(&Config{}).Elem()) {
+		if names[f.EnvName()] {
+			t.Errorf("variable %s overrides more than one field", f.EnvName())
+		}
+		names[f.EnvName()] = true
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Server.Auth.Users = []AuthUserConfig{{Name: "alice", PasswordHash: "$2y$10$secret"}}
+	cfg.Collectors.Probes = []ProbeConfig{{Name: "api", Headers: map[string]string{"Authorization": "Bearer secret"}}}
+
+	redactedCfg, err := cfg.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redactedCfg.Server.Auth.Users[0].PasswordHash != redacted || redactedCfg.Collectors.Probes[0].Headers["Authorization"] != redacted {
+		t.Errorf("expected secrets to be redacted, got %+v %+v", redactedCfg.Server.Auth.Users, redactedCfg.Collectors.Probes)
+	}
+	if redactedCfg.Server.Auth.Users[0].Name != "alice" || cfg.Server.Auth.Users[0].PasswordHash != "$2y$10$secret" {
+		t.Errorf("expected other fields and the original to be kept")
+	}
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix = "METRICLY_"
+	redacted  = "<redacted>"
+)
+
+// flagOverrides holds the values of config flags registered by RegisterFlags,
+// applied over the file and environment by every LoadConfig, including
+// reloads
+var flagOverrides = make(map[string]string)
+
+// field is a config field settable by flag and environment variable
+type field struct {
+	// yaml path, e.g. collectors.systemd.unit_include
+	Path  string
+	Value reflect.Value
+}
+
+// EnvName returns the environment variable overriding a field, e.g.
+// METRICLY_COLLECTORS_SYSTEMD_UNIT_INCLUDE
+func (f field) EnvName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(f.Path, ".", "_"))
+}
+
+// fields lists the settable fields of a config struct: scalars, lists and
+// maps, nested structs are walked
+func fields(prefix string, value reflect.Value) []field {
+	var result []field
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if value.Field(i).Kind() == reflect.Struct {
+			result = append(result, fields(name, value.Field(i))...)
+			continue
+		}
+		result = append(result, field{Path: name, Value: value.Field(i)})
+	}
+	return result
+}
+
+// set parses raw into the field. Strings are taken as-is, string lists are
+// comma separated unless given in YAML flow style, e.g. [a, b], and other
+// values are parsed as YAML, e.g. 10s, true or [{address: ":8080"}].
+func (f field) set(raw string) error {
+	switch {
+	case f.Value.Kind() == reflect.String:
+		f.Value.SetString(raw)
+		return nil
+	case f.Value.Type() == reflect.TypeOf([]string{}) && !strings.HasPrefix(strings.TrimSpace(raw), "["):
+		f.Value.Set(reflect.ValueOf(strings.Split(raw, ",")))
+		return nil
+	}
+
+	parsed := reflect.New(f.Value.Type())
+	decoder := yaml.NewDecoder(strings.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(parsed.Interface()); err != nil {
+		return fmt.Errorf("invalid value %q: %v", raw, err)
+	}
+	f.Value.Set(parsed.Elem())
+	return nil
+}
+
+// overrideFlag records the value of a config flag
+type overrideFlag struct {
+	path   string
+	isBool bool
+}
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(value string) error {
+	flagOverrides[f.path] = value
+	return nil
+}
+
+// IsBoolFlag allows boolean fields to be enabled by a flag without value
+func (f *overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// RegisterFlags adds a flag per config field to flags, named after its path,
+// e.g. -server.port or -collectors.systemd.enabled
+func RegisterFlags(flags *flag.FlagSet) {
+	var cfg Config
+	for _, f := range fields("", reflect.ValueOf(&cfg).Elem()) {
+		usage := fmt.Sprintf("overrides %s of the config file and %s", f.Path, f.EnvName())
+		flags.Var(&overrideFlag{path: f.Path, isBool: f.Value.Kind() == reflect.Bool}, f.Path, usage)
+	}
+}
+
+// applyOverrides sets the fields given by METRICLY_ environment variables,
+// then those given by flags
+func (c *Config) applyOverrides() error {
+	configFields := fields("", reflect.ValueOf(c).Elem())
+	for _, f := range configFields {
+		if env := os.Getenv(f.EnvName()); env != "" {
+			if err := f.set(env); err != nil {
+				return fmt.Errorf("invalid %s: %v", f.EnvName(), err)
+			}
+		}
+	}
+	for _, f := range configFields {
+		if value, exists := flagOverrides[f.Path]; exists {
+			if err := f.set(value); err != nil {
+				return fmt.Errorf("invalid -%s: %v", f.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets, fields tagged
+// `secret:"true"`, replaced so it can be printed
+func (c *Config) Redacted() (*Config, error) {
+	// a round trip copies lists instead of sharing them
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var copied Config
+	if err := yaml.Unmarshal(content, &copied); err != nil {
+		return nil, err
+	}
+	redact(reflect.ValueOf(&copied).Elem())
+	return &copied, nil
+}
+
+func redact(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).Tag.Get("secret") == "true" {
+				redactSecret(value.Field(i))
+				continue
+			}
+			redact(value.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			redact(value.Index(i))
+		}
+	}
+}
+
+// redactSecret replaces a secret string or the values of a map of secrets,
+// empty ones are kept to tell they're not set
+func redactSecret(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.String:
+		if value.String() != "" {
+			value.SetString(redacted)
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			value.SetMapIndex(key, reflect.ValueOf(redacted))
+		}
+	}
+}
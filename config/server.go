@@ -0,0 +1,85 @@
+package config
+
+import "time"
+
+// ServerTLSConfig configures TLS of the metricly server, which serves
+// cleartext HTTP if CertFile is empty
+type ServerTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CA verifying client certificates, which are only requested if set
+	ClientCAFile      string `yaml:"client_ca_file"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+	// 1.2 or 1.3, defaults to 1.2
+	MinVersion string `yaml:"min_version"`
+	// names as listed by crypto/tls, only apply to TLS 1.2
+	CipherSuites []string `yaml:"cipher_suites"`
+}
+
+// ClientCertPrefix prefixes the common name of client certificates to form
+// their identity, e.g. cert:prometheus, so they can't pass for a user or token
+const ClientCertPrefix = "cert:"
+
+// AuthConfig configures authentication of the metricly server, which is open
+// to everyone if it's empty
+type AuthConfig struct {
+	Users  []AuthUserConfig  `yaml:"users"`
+	Tokens []AuthTokenConfig `yaml:"tokens"`
+	Routes []AuthRouteConfig `yaml:"routes"`
+}
+
+// AuthUserConfig is a basic auth user, authenticated against a bcrypt hash
+type AuthUserConfig struct {
+	Name         string `yaml:"name"`
+	PasswordHash string `yaml:"password_hash" secret:"true"`
+}
+
+// AuthTokenConfig is a bearer token read from a file, identified by Name
+type AuthTokenConfig struct {
+	Name      string `yaml:"name"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// AuthRouteConfig restricts requests whose path starts with Path. Allow lists
+// users, token names and client certificate common names prefixed with
+// ClientCertPrefix, any authenticated identity is accepted if empty.
+type AuthRouteConfig struct {
+	Path      string   `yaml:"path"`
+	Anonymous bool     `yaml:"anonymous"`
+	Allow     []string `yaml:"allow"`
+}
+
+// LimitsConfig protects Prometheus from clients of the query endpoints
+type LimitsConfig struct {
+	// token bucket per client address, disabled if 0
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// defaults to requests_per_second rounded up
+	Burst int `yaml:"burst"`
+	// queries proxied at once, others wait up to MaxQueueWait, disabled if 0
+	MaxConcurrentQueries int `yaml:"max_concurrent_queries"`
+	// defaults to 10s
+	MaxQueueWait time.Duration `yaml:"max_queue_wait"`
+	// points per series of range queries, defaults to 11000 like Prometheus
+	MaxRangePoints int `yaml:"max_range_points"`
+}
+
+// ListenConfig is an address the server listens on, either TCP or a unix
+// socket
+type ListenConfig struct {
+	// host:port
+	Address string `yaml:"address"`
+	// socket path, created with Mode and owned by Owner and Group if set
+	Unix string `yaml:"unix"`
+	// octal, e.g. "0660"
+	Mode  string `yaml:"mode"`
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+}
+
+// ReloadConfig configures how the configuration is reloaded besides SIGHUP
+type ReloadConfig struct {
+	// serve POST /-/reload, authenticated like the API
+	Endpoint bool `yaml:"endpoint"`
+	// check the config file for changes this often, disabled if 0
+	WatchInterval time.Duration `yaml:"watch_interval"`
+}
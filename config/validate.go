@@ -0,0 +1,297 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaults of fields missing from the config file
+const (
+	defaultServerAddress      = "0.0.0.0"
+	defaultServerPort         = "8080"
+	defaultCollectionInterval = 10 * time.Second
+	defaultShutdownTimeout    = 10 * time.Second
+
+	// shorter intervals are most likely a missing unit, e.g. "interval: 10"
+	// being 10ns
+	minCollectionInterval = time.Second
+)
+
+var hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+// defaultConfig returns the configuration the config file is decoded over
+func defaultConfig() Config {
+	var cfg Config
+	cfg.Server.Address = defaultServerAddress
+	cfg.Server.Port = defaultServerPort
+	cfg.Server.ShutdownTimeout = defaultShutdownTimeout
+	cfg.CollectionInterval = defaultCollectionInterval
+	return cfg
+}
+
+// ValidationError lists every invalid field of a configuration, prefixed
+// with the path of the field, e.g. "server.listen[1].address"
+type ValidationError struct {
+	Fields []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Fields, "\n")
+}
+
+// fieldErrors collects the errors of Validate
+type fieldErrors []string
+
+func (e *fieldErrors) add(path string, format string, args ...any) {
+	*e = append(*e, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (e *fieldErrors) host(path, host string) {
+	if host != "" && net.ParseIP(host) == nil && !hostnameRegex.MatchString(host) {
+		e.add(path, "invalid IP address or hostname %q", host)
+	}
+}
+
+func (e *fieldErrors) port(path, port string) {
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		e.add(path, "invalid port %q, must be between 1 and 65535", port)
+	}
+}
+
+func (e *fieldErrors) hostPort(path, address string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		e.add(path, "must be host:port, got %q", address)
+		return
+	}
+	e.host(path, host)
+	e.port(path, port)
+}
+
+func (e *fieldErrors) regex(path, regex string) {
+	if _, err := regexp.Compile(regex); err != nil {
+		e.add(path, "invalid regex: %v", err)
+	}
+}
+
+func (e *fieldErrors) required(path, value string) {
+	if value == "" {
+		e.add(path, "is required")
+	}
+}
+
+func (e *fieldErrors) positive(path string, value float64) {
+	if value < 0 {
+		e.add(path, "must not be negative")
+	}
+}
+
+// interval checks a collection interval or timeout, zero means the default
+// is used
+func (e *fieldErrors) interval(path string, value time.Duration) {
+	if value != 0 && value < minCollectionInterval {
+		e.add(path, "must be at least %s, got %s, durations need a unit like 10s", minCollectionInterval, value)
+	}
+}
+
+// Validate checks every field of the configuration, details only known to
+// pollsters, like capture groups of their regexes, are checked when they
+// register
+func (c *Config) Validate() error {
+	var errs fieldErrors
+
+	errs.host("server.address", c.Server.Address)
+	errs.port("server.port", c.Server.Port)
+	c.validateListen(&errs)
+	c.validateTLS(&errs)
+	c.validateAuth(&errs)
+
+	limits := c.Server.Limits
+	errs.positive("server.limits.requests_per_second", limits.RequestsPerSecond)
+	errs.positive("server.limits.burst", float64(limits.Burst))
+	errs.positive("server.limits.max_concurrent_queries", float64(limits.MaxConcurrentQueries))
+	errs.positive("server.limits.max_queue_wait", float64(limits.MaxQueueWait))
+	errs.positive("server.limits.max_range_points", float64(limits.MaxRangePoints))
+	errs.positive("server.reload.watch_interval", float64(c.Server.Reload.WatchInterval))
+	if c.Server.ShutdownTimeout <= 0 {
+		errs.add("server.shutdown_timeout", "must be greater than zero, got %s", c.Server.ShutdownTimeout)
+	}
+
+	// the query endpoints are disabled without Prometheus
+	if (c.Prometheus.Address == "") != (c.Prometheus.Port == "") {
+		errs.add("prometheus", "address and port must be set together")
+	} else if c.Prometheus.Address != "" {
+		errs.host("prometheus.address", c.Prometheus.Address)
+		errs.port("prometheus.port", c.Prometheus.Port)
+	}
+
+	if c.CollectionInterval < minCollectionInterval {
+		errs.add("interval", "must be at least %s, got %s, durations need a unit like 10s", minCollectionInterval, c.CollectionInterval)
+	}
+
+	c.Collectors.validate(&errs)
+
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+func (c *Config) validateListen(errs *fieldErrors) {
+	for i, listen := range c.Server.Listen {
+		path := fmt.Sprintf("server.listen[%d]", i)
+		switch {
+		case listen.Address != "" && listen.Unix != "":
+			errs.add(path, "address and unix are exclusive")
+		case listen.Unix != "":
+			if listen.Mode != "" {
+				if mode, err := strconv.ParseUint(listen.Mode, 8, 32); err != nil || mode > 0o777 {
+					errs.add(path+".mode", "invalid mode %q, must be octal like 0660", listen.Mode)
+				}
+			}
+		case listen.Address != "":
+			errs.hostPort(path+".address", listen.Address)
+			if listen.Mode != "" || listen.Owner != "" || listen.Group != "" {
+				errs.add(path, "mode, owner and group only apply to unix sockets")
+			}
+		default:
+			errs.add(path, "address or unix is required")
+		}
+	}
+}
+
+func (c *Config) validateTLS(errs *fieldErrors) {
+	settings := c.Server.TLS
+	if (settings.CertFile == "") != (settings.KeyFile == "") {
+		errs.add("server.tls", "cert_file and key_file must be set together")
+	}
+	if settings.CertFile == "" && (settings.ClientCAFile != "" || settings.RequireClientCert || settings.MinVersion != "" || len(settings.CipherSuites) > 0) {
+		errs.add("server.tls", "settings need cert_file and key_file")
+	}
+	if settings.RequireClientCert && settings.ClientCAFile == "" {
+		errs.add("server.tls.require_client_cert", "needs client_ca_file")
+	}
+
+	switch settings.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		errs.add("server.tls.min_version", "unsupported version %q, must be 1.2 or 1.3", settings.MinVersion)
+	}
+
+	known := make(map[string]bool)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = true
+	}
+	for i, name := range settings.CipherSuites {
+		if !known[name] {
+			errs.add(fmt.Sprintf("server.tls.cipher_suites[%d]", i), "unsupported cipher suite %q", name)
+		}
+	}
+}
+
+func (c *Config) validateAuth(errs *fieldErrors) {
+	auth := c.Server.Auth
+	names := make(map[string]bool)
+	for i, user := range auth.Users {
+		path := fmt.Sprintf("server.auth.users[%d]", i)
+		if user.Name == "" || names[user.Name] || strings.HasPrefix(user.Name, ClientCertPrefix) {
+			errs.add(path+".name", "user name %q is empty, already used or reserved for client certificates", user.Name)
+		}
+		names[user.Name] = true
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			errs.add(path+".password_hash", "invalid bcrypt hash: %v", err)
+		}
+	}
+	for i, token := range auth.Tokens {
+		path := fmt.Sprintf("server.auth.tokens[%d]", i)
+		if token.Name == "" || names[token.Name] || strings.HasPrefix(token.Name, ClientCertPrefix) {
+			errs.add(path+".name", "token name %q is empty, already used or reserved for client certificates", token.Name)
+		}
+		names[token.Name] = true
+		errs.required(path+".token_file", token.TokenFile)
+	}
+	for i, route := range auth.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			errs.add(fmt.Sprintf("server.auth.routes[%d].path", i), "must start with /, got %q", route.Path)
+		}
+	}
+}
+
+func (c *Collectors) validate(errs *fieldErrors) {
+	scriptNames := make(map[string]bool)
+	for i, script := range c.Scripts {
+		path := fmt.Sprintf("collectors.scripts[%d]", i)
+		errs.required(path+".name", script.Name)
+		// series of scripts are labelled with their name
+		if script.Name != "" && scriptNames[script.Name] {
+			errs.add(path+".name", "script name %q is already used", script.Name)
+		}
+		scriptNames[script.Name] = true
+		if len(script.Command) == 0 {
+			errs.add(path+".command", "is required")
+		}
+		errs.interval(path+".interval", script.Interval)
+		errs.interval(path+".timeout", script.Timeout)
+		errs.positive(path+".max_output_bytes", float64(script.MaxOutputBytes))
+		switch script.Format {
+		case "", "prometheus", "json":
+		default:
+			errs.add(path+".format", "unsupported format %q, must be prometheus or json", script.Format)
+		}
+	}
+
+	for i, scrape := range c.FileScrape {
+		path := fmt.Sprintf("collectors.file_scrape[%d]", i)
+		errs.required(path+".name", scrape.Name)
+		errs.required(path+".path", scrape.Path)
+		errs.regex(path+".regex", scrape.Regex)
+		switch scrape.Type {
+		case "", "gauge", "counter":
+		default:
+			errs.add(path+".type", "unsupported type %q, must be gauge or counter", scrape.Type)
+		}
+	}
+
+	for i, file := range c.Logtail.Files {
+		path := fmt.Sprintf("collectors.logtail.files[%d]", i)
+		errs.required(path+".path", file.Path)
+		if len(file.Rules) == 0 {
+			errs.add(path+".rules", "at least one rule is required")
+		}
+		for j, rule := range file.Rules {
+			rulePath := fmt.Sprintf("%s.rules[%d]", path, j)
+			errs.required(rulePath+".name", rule.Name)
+			errs.regex(rulePath+".regex", rule.Regex)
+			switch rule.Type {
+			case "", "counter", "histogram":
+			default:
+				errs.add(rulePath+".type", "unsupported type %q, must be counter or histogram", rule.Type)
+			}
+		}
+	}
+
+	for i, probe := range c.Probes {
+		path := fmt.Sprintf("collectors.probes[%d]", i)
+		errs.required(path+".name", probe.Name)
+		errs.required(path+".target", probe.Target)
+		switch probe.Type {
+		case "http", "tcp", "tls":
+		default:
+			errs.add(path+".type", "unsupported type %q, must be http, tcp or tls", probe.Type)
+		}
+		errs.interval(path+".interval", probe.Interval)
+		errs.interval(path+".timeout", probe.Timeout)
+		errs.regex(path+".body_regex", probe.BodyRegex)
+	}
+
+	errs.regex("collectors.systemd.unit_include", c.Systemd.UnitInclude)
+	errs.regex("collectors.systemd.unit_exclude", c.Systemd.UnitExclude)
+	errs.positive("collectors.kubernetes.cache_ttl", float64(c.Kubernetes.CacheTTL))
+}
@@ -4,27 +4,46 @@ import (
 	"fmt"
 	"log/slog"
 	"metricly/pkg/common"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
+// descRegex extracts the metric name and help of a prometheus.Desc, which
+// has no accessors for them
+var descRegex = regexp.MustCompile(`^Desc{fqName: ("(?:[^"\\]|\\.)*"), help: ("(?:[^"\\]|\\.)*")`)
+
 type metricData struct {
 	Value  float64
 	Labels []string
+	// last update, series of stopped pollsters are dropped by DropStale
+	Updated time.Time
 }
 
 type MetriclyCollector struct {
 	Metrics map[string]*prometheus.Desc
 	Data    map[string]metricData
+	// Sources holds series built by pollsters which don't know their
+	// metric names upfront (e.g. textfile), keyed by pollster
+	Sources map[string][]prometheus.Metric
 	Mutex   sync.Mutex
+
+	sourcesUpdated map[string]time.Time
 }
 
 func CreateMetricCollector() *MetriclyCollector {
 	return &MetriclyCollector{
 		Metrics: make(map[string]*prometheus.Desc),
 		Data:    make(map[string]metricData),
+		Sources: make(map[string][]prometheus.Metric),
+
+		sourcesUpdated: make(map[string]time.Time),
 	}
 }
 
@@ -58,6 +77,12 @@ func (mc *MetriclyCollector) Collect(ch chan<- prometheus.Metric) {
 		// ch <- metric
 		// }
 	}
+
+	for _, metrics := range mc.Sources {
+		for _, metric := range metrics {
+			ch <- metric
+		}
+	}
 }
 
 func (mc *MetriclyCollector) AddMetric(name string, description string, labels []string) {
@@ -78,6 +103,202 @@ func (mc *MetriclyCollector) AddMetric(name string, description string, labels [
 	// }
 }
 
+// family holds what series sharing a metric name must agree on, the scrape
+// fails otherwise
+type family struct {
+	Help   string
+	Type   string
+	Labels string
+	Source string
+}
+
+// sourceSeries describes a metric built by a pollster
+type sourceSeries struct {
+	Name string
+	// name and label values, unique across every source
+	ID string
+	family
+}
+
+// describe returns the name, label values and family of a metric
+func describe(source string, metric prometheus.Metric) (sourceSeries, error) {
+	match := descRegex.FindStringSubmatch(metric.Desc().String())
+	if match == nil {
+		return sourceSeries{}, fmt.Errorf("invalid descriptor %s", metric.Desc())
+	}
+	name, _ := strconv.Unquote(match[1])
+	help, _ := strconv.Unquote(match[2])
+
+	var written dto.Metric
+	if err := metric.Write(&written); err != nil {
+		return sourceSeries{}, fmt.Errorf("invalid metric %s: %v", name, err)
+	}
+	labels := slices.Clone(written.Label)
+	slices.SortFunc(labels, func(a, b *dto.LabelPair) int { return strings.Compare(a.GetName(), b.GetName()) })
+	names := make([]string, 0, len(labels))
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		names = append(names, label.GetName())
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+
+	metricType := "untyped"
+	switch {
+	case written.Gauge != nil:
+		metricType = "gauge"
+	case written.Counter != nil:
+		metricType = "counter"
+	case written.Histogram != nil:
+		metricType = "histogram"
+	case written.Summary != nil:
+		metricType = "summary"
+	}
+
+	return sourceSeries{
+		Name: name,
+		ID:   fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ",")),
+		family: family{
+			Help:   help,
+			Type:   metricType,
+			Labels: strings.Join(names, ","),
+			Source: source,
+		},
+	}, nil
+}
+
+// conflict tells why s can't be gathered along with the series of f
+func (s sourceSeries) conflict(f family) error {
+	switch {
+	case s.Help != f.Help:
+		return fmt.Errorf("metric %s has help %q but %s reports it with %q", s.Name, s.Help, f.Source, f.Help)
+	case s.Type != f.Type:
+		return fmt.Errorf("metric %s is a %s but %s reports it as a %s", s.Name, s.Type, f.Source, f.Type)
+	case s.Labels != f.Labels:
+		return fmt.Errorf("metric %s has labels {%s} but %s reports it with {%s}", s.Name, s.Labels, f.Source, f.Labels)
+	}
+	return nil
+}
+
+// SetMetrics replaces every series previously reported by source. Series
+// conflicting with those of metricly, of another source or of the same
+// batch would fail the whole scrape, so the series of source are dropped
+// instead.
+func (mc *MetriclyCollector) SetMetrics(source string, metrics []prometheus.Metric) error {
+	mc.Mutex.Lock()
+	defer mc.Mutex.Unlock()
+
+	mc.sourcesUpdated[source] = time.Now()
+
+	families := make(map[string]family)
+	owners := make(map[string]string)
+	for other, otherMetrics := range mc.Sources {
+		if other == source {
+			continue
+		}
+		for _, metric := range otherMetrics {
+			// accepted by a previous call
+			s, _ := describe(other, metric)
+			families[s.Name] = s.family
+			owners[s.ID] = other
+		}
+	}
+
+	reject := func(err error) error {
+		delete(mc.Sources, source)
+		return err
+	}
+	for _, metric := range metrics {
+		s, err := describe(source, metric)
+		if err != nil {
+			return reject(err)
+		}
+		if _, exists := mc.Metrics[s.Name]; exists {
+			return reject(fmt.Errorf("metric %s clashes with metricly's own metrics", s.Name))
+		}
+		if f, exists := families[s.Name]; exists {
+			if err := s.conflict(f); err != nil {
+				return reject(err)
+			}
+		}
+		if owner, exists := owners[s.ID]; exists {
+			if owner == source {
+				return reject(fmt.Errorf("series %s is reported twice", s.ID))
+			}
+			return reject(fmt.Errorf("series %s is already reported by %s", s.ID, owner))
+		}
+		families[s.Name] = s.family
+		owners[s.ID] = source
+	}
+
+	mc.Sources[source] = metrics
+	return nil
+}
+
+// DropStale drops every series not reported since a time, e.g. series of
+// pollsters disabled by a configuration reload
+func (mc *MetriclyCollector) DropStale(since time.Time) {
+	mc.Mutex.Lock()
+	defer mc.Mutex.Unlock()
+
+	for key, data := range mc.Data {
+		if data.Updated.Before(since) {
+			delete(mc.Data, key)
+		}
+	}
+	for source, updated := range mc.sourcesUpdated {
+		if updated.Before(since) {
+			delete(mc.Sources, source)
+			delete(mc.sourcesUpdated, source)
+		}
+	}
+}
+
+// Series is a value of a metric with its label values
+type Series struct {
+	Value  float64
+	Labels []string
+}
+
+// ReplaceMetric swaps every reported series of a metric for series, for
+// metrics whose label values can change between collections. Scrapes see
+// either the previous or the new series.
+func (mc *MetriclyCollector) ReplaceMetric(name string, series []Series) {
+	mc.Mutex.Lock()
+	defer mc.Mutex.Unlock()
+
+	// prepend exporter name to every metric name
+	name = fmt.Sprintf("metricly_%s", name)
+
+	for key := range mc.Data {
+		if key == name || strings.HasPrefix(key, name+"|") {
+			delete(mc.Data, key)
+		}
+	}
+	now := time.Now()
+	for _, s := range series {
+		key := name
+		if len(s.Labels) > 0 {
+			key = fmt.Sprintf("%s|%s", name, strings.Join(s.Labels, "|"))
+		}
+		mc.Data[key] = metricData{
+			Value:   s.Value,
+			Labels:  s.Labels,
+			Updated: now,
+		}
+	}
+}
+
+// DeleteMetric drops a single reported series of a metric
+func (mc *MetriclyCollector) DeleteMetric(name string, labels []string) {
+	mc.Mutex.Lock()
+	defer mc.Mutex.Unlock()
+
+	if len(labels) > 0 {
+		name = fmt.Sprintf("%s|%s", name, strings.Join(labels, "|"))
+	}
+	delete(mc.Data, fmt.Sprintf("metricly_%s", name))
+}
+
 func (mc *MetriclyCollector) UpdateMetric(name string, value float64, labels []string) {
 	mc.Mutex.Lock()
 	defer mc.Mutex.Unlock()
@@ -97,8 +318,9 @@ func (mc *MetriclyCollector) UpdateMetric(name string, value float64, labels []s
 	// labels = append(labels, common.GetHostname())
 
 	mc.Data[name] = metricData{
-		Value:  value,
-		Labels: labels,
+		Value:   value,
+		Labels:  labels,
+		Updated: time.Now(),
 	}
 	// }
 
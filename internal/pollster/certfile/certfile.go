@@ -0,0 +1,185 @@
+package certfile
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	certificatePaths []string
+	keystorePassword string
+)
+
+// certInfo holds the fields of a certificate found on disk
+type certInfo struct {
+	Path      string
+	Subject   string
+	Issuer    string
+	Serial    string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// labelValue replaces "|", which the collector uses to separate label
+// values, in paths and distinguished names
+func labelValue(name string) string {
+	return strings.ReplaceAll(name, "|", "_")
+}
+
+// isKeystore tells PKCS#12 keystores apart by their extension
+func isKeystore(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		return true
+	}
+	return false
+}
+
+// parseCertificates extracts certificates out of PEM, DER or PKCS#12
+// content. Private keys and other PEM blocks are ignored.
+func parseCertificates(content []byte, keystore bool, password string) ([]*x509.Certificate, error) {
+	if keystore {
+		// converts every bag of the keystore, chains included, to PEM,
+		// including keystores encrypted with AES as written by OpenSSL 3
+		blocks, err := pkcs12.ToPEM(content, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode keystore: %v", err)
+		}
+		var pemContent []byte
+		for _, block := range blocks {
+			pemContent = append(pemContent, pem.EncodeToMemory(block)...)
+		}
+		content = pemContent
+	}
+
+	var (
+		certs    []*x509.Certificate
+		foundPEM bool
+	)
+	rest := content
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		foundPEM = true
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if !foundPEM {
+		// not PEM, try DER encoded certificates
+		var err error
+		if certs, err = x509.ParseCertificates(content); err != nil {
+			return nil, fmt.Errorf("neither PEM nor DER encoded certificates: %v", err)
+		}
+	}
+	return certs, nil
+}
+
+// readCertificates reads every certificate of the files matching paths
+func readCertificates() ([]certInfo, map[string]bool) {
+	var certs []certInfo
+	fileErrors := make(map[string]bool)
+
+	for _, pattern := range certificatePaths {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("invalid certificate path %s: %v", pattern, err))
+			continue
+		}
+		if len(paths) == 0 {
+			slog.Debug(fmt.Sprintf("no certificate matches %s", pattern))
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			if _, seen := fileErrors[path]; seen {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err == nil {
+				var parsed []*x509.Certificate
+				parsed, err = parseCertificates(content, isKeystore(path), keystorePassword)
+				if err == nil && len(parsed) == 0 {
+					err = fmt.Errorf("no certificate found")
+				}
+				for _, cert := range parsed {
+					certs = append(certs, certInfo{
+						Path:      labelValue(path),
+						Subject:   labelValue(cert.Subject.String()),
+						Issuer:    labelValue(cert.Issuer.String()),
+						Serial:    cert.SerialNumber.Text(16),
+						NotBefore: cert.NotBefore,
+						NotAfter:  cert.NotAfter,
+					})
+				}
+			}
+			if err != nil {
+				slog.Warn(fmt.Sprintf("failed to read certificates from %s: %v", path, err))
+			}
+			fileErrors[path] = err != nil
+		}
+	}
+	return certs, fileErrors
+}
+
+// RegisterCertFileMetrics registers certificate metrics and sets the paths
+// scanned for certificates.
+func RegisterCertFileMetrics(mc *collector.MetriclyCollector, certificates config.CertificatesConfig) {
+	certificatePaths = certificates.Paths
+	keystorePassword = certificates.KeystorePassword
+
+	labels := []string{"path", "subject", "issuer", "serial"}
+	mc.AddMetric("cert_not_before_timestamp_seconds", "Certificate validity start as unix timestamp", labels)
+	mc.AddMetric("cert_not_after_timestamp_seconds", "Certificate expiry as unix timestamp", labels)
+	mc.AddMetric("cert_file_error", "1 if the file could not be read or holds no valid certificate, 0 otherwise", []string{"path"})
+}
+
+// ReportCertFiles reports validity of certificates found on disk.
+func ReportCertFiles(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	certs, fileErrors := readCertificates()
+
+	var notBefore, notAfter, failures []collector.Series
+	for _, cert := range certs {
+		labels := []string{cert.Path, cert.Subject, cert.Issuer, cert.Serial}
+		notBefore = append(notBefore, collector.Series{Value: float64(cert.NotBefore.Unix()), Labels: labels})
+		notAfter = append(notAfter, collector.Series{Value: float64(cert.NotAfter.Unix()), Labels: labels})
+	}
+	for path, failed := range fileErrors {
+		fileError := 0.0
+		if failed {
+			fileError = 1
+		}
+		failures = append(failures, collector.Series{Value: fileError, Labels: []string{labelValue(path)}})
+	}
+	// renewed or removed certificates must not be reported anymore
+	mc.ReplaceMetric("cert_not_before_timestamp_seconds", notBefore)
+	mc.ReplaceMetric("cert_not_after_timestamp_seconds", notAfter)
+	mc.ReplaceMetric("cert_file_error", failures)
+
+	// unreadable files are reported by cert_file_error
+	slog.Info(fmt.Sprintf("Collected Certificate metrics in %s", time.Since(start)))
+	return nil
+}
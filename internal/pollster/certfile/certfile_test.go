@@ -0,0 +1,149 @@
+package certfile
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// PKCS#12 keystore protected by "changeit" holding a certificate for
+// CN=etcd-peer,O=metricly with serial 0x1234 expiring on 2126-09-25
+var etcdKeystore = `
+	MIIDkgIBAzCCA1gGCSqGSIb3DQEHAaCCA0kEggNFMIIDQTCCAjcGCSqGSIb3DQEHBqCCAigwggIk
+	AgEAMIICHQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQMwDgQIRLPfrTqoPIQCAggAgIIB8J036lBs
+	ATTLyckDrPMsORkep1jVnVkhNfES+BFJFOCIPmvIqlsPomt9o4KRjKzpw+YdLQ9rBfPfvRT8WvXa
+	lue59xYy9/NRVMVjmKH14VmaNuA3wwe4IeuU4r5COKNTP3VCc81sGdDmqx4YmXf2zrX1BMu41c5r
+	OXY+vDwTL5MdWCDswsZ2kwuxvK6ZsbqK7+zNQVudHaXZFsV0vBW44dReyvHxIztWY8zeWvMhMqot
+	FCT9msoofo8HusuEMoX6NEp0kSAoSiaSus2UXLZlE7pTmelqBQSJCRT7QWdk7PdE0evo1fxl6nze
+	Gq7cK3it0T6wFBf0goDRJdjVSDJumVqsMveXKsd2b7WS3a4mwCSFAGgo955U6st0/bSjqeSaB9Sv
+	jvaHUdglstF9EttjTlX6zlV4rOhTMtFqfDrwAX1V48jm6WqIl6cD42bUvKE/alYJkw17TFfZ5O+2
+	ZuKEvUx/dXTM/iurj4NB5LmhEhtYm80wPHEpmtKauNQMo/4FWU8KpO5dhmK452umeChiQJbUfgQM
+	99GctiMT5j6vSTYu+h9KBOzpK5ruOgPBgM3u+jCuiuNqnBIoVi8Ez/uwvGQyVuJbvbo4w1dRpnNs
+	8xY40uvp5W37WOV6eF8jIoqv99Gx7TVUVCOCQwqB+/rSbTcwggECBgkqhkiG9w0BBwGggfQEgfEw
+	ge4wgesGCyqGSIb3DQEMCgECoIG0MIGxMBwGCiqGSIb3DQEMAQMwDgQImRPf7XMC8akCAggABIGQ
+	eLAXKi4mCwnypTmsz+AYPm3xJNjBOtEZTuPb2rF75dJ0rOrLnz9Y/DStxg0zvKxL3v48FQUeX0HR
+	B0eLPmbzWl02H8iTtWzerGUtZCjKLvJnMv6bB+eXzmQEBor1xm03sdxHzN9I175yQdu0fDJInhUv
+	nccwGcUlW8FEIp7Uy4qcD+3FcikHCUzqwOXPfP+QMSUwIwYJKoZIhvcNAQkVMRYEFI2uDcFTrthO
+	TMFTXM3nPcDp9wj9MDEwITAJBgUrDgMCGgUABBSDn+7hHrNwasv+L1pj4PSodgxyEgQIiXNEK9y9
+	JTYCAggA
+`
+
+// newCertificate returns a DER encoded self-signed certificate
+func newCertificate(t *testing.T, commonName string, serial int64, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Unix(1700000000, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func encodePEM(blockType string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+func TestReportCertFiles(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+
+	keystore, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(etcdKeystore), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiserver := newCertificate(t, "kube-apiserver", 1, time.Unix(1800000000, 0))
+	ca := newCertificate(t, "kubernetes", 2, time.Unix(1900000000, 0))
+	kubelet := newCertificate(t, "system:node:worker-0", 255, time.Unix(1750000000, 0))
+
+	// keystores written by OpenSSL 3 are encrypted with AES
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyCert, err := x509.ParseCertificate(newCertificate(t, "front-proxy", 4, time.Unix(1850000000, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesKeystore, err := pkcs12.Modern.Encode(key, proxyCert, nil, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := helper.SetupSysfsTree(t, map[string]string{
+		// chain with a private key, which is ignored
+		"pki/apiserver.crt": encodePEM("CERTIFICATE", apiserver) + encodePEM("EC PRIVATE KEY", []byte("key")) + encodePEM("CERTIFICATE", ca),
+		"pki/kubelet.der":   string(kubelet),
+		"pki/broken.crt":    "not a certificate\n",
+		"etcd/peer.p12":     string(keystore),
+		"proxy/client.pfx":  string(aesKeystore),
+		"proxy/a|b.crt":     encodePEM("CERTIFICATE", apiserver),
+	})
+
+	mc := collector.CreateMetricCollector()
+	RegisterCertFileMetrics(mc, config.CertificatesConfig{
+		Paths: []string{
+			filepath.Join(root, "pki/*"),
+			filepath.Join(root, "etcd/peer.p12"),
+			filepath.Join(root, "proxy/*"),
+			// matched twice, reported once
+			filepath.Join(root, "pki/apiserver.crt"),
+		},
+		KeystorePassword: "changeit",
+	})
+
+	ReportCertFiles(context.Background(), mc)
+
+	apiserverPath := filepath.Join(root, "pki/apiserver.crt")
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+apiserverPath+"|CN=kube-apiserver|CN=kube-apiserver|1", 1800000000)
+	helper.VerifyMetric(t, mc, "metricly_cert_not_before_timestamp_seconds|"+apiserverPath+"|CN=kube-apiserver|CN=kube-apiserver|1", 1700000000)
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+apiserverPath+"|CN=kubernetes|CN=kubernetes|2", 1900000000)
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+filepath.Join(root, "pki/kubelet.der")+"|CN=system:node:worker-0|CN=system:node:worker-0|ff", 1750000000)
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+filepath.Join(root, "etcd/peer.p12")+"|CN=etcd-peer,O=metricly|CN=etcd-peer,O=metricly|1234", 4946010061)
+
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+filepath.Join(root, "proxy/client.pfx")+"|CN=front-proxy|CN=front-proxy|4", 1850000000)
+	// "|" separates label values of the collector
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+filepath.Join(root, "proxy/a_b.crt")+"|CN=kube-apiserver|CN=kube-apiserver|1", 1800000000)
+
+	helper.VerifyMetric(t, mc, "metricly_cert_file_error|"+apiserverPath, 0)
+	helper.VerifyMetric(t, mc, "metricly_cert_file_error|"+filepath.Join(root, "pki/broken.crt"), 1)
+	helper.VerifyMetric(t, mc, "metricly_cert_file_error|"+filepath.Join(root, "etcd/peer.p12"), 0)
+
+	// a wrong keystore password is reported as an error
+	keystorePassword = "wrong"
+	// renewed certificates replace the old series
+	renewed := newCertificate(t, "kube-apiserver", 3, time.Unix(2000000000, 0))
+	if err := os.WriteFile(apiserverPath, []byte(encodePEM("CERTIFICATE", renewed)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ReportCertFiles(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_cert_file_error|"+filepath.Join(root, "etcd/peer.p12"), 1)
+	helper.VerifyMetric(t, mc, "metricly_cert_not_after_timestamp_seconds|"+apiserverPath+"|CN=kube-apiserver|CN=kube-apiserver|3", 2000000000)
+	if _, exists := mc.Data["metricly_cert_not_after_timestamp_seconds|"+apiserverPath+"|CN=kube-apiserver|CN=kube-apiserver|1"]; exists {
+		t.Errorf("expected series of the replaced certificate to be dropped")
+	}
+}
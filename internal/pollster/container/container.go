@@ -0,0 +1,275 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// libpod API version, served by Podman 4 and later
+	apiPrefix = "http://podman/v4.0.0/libpod"
+
+	requestTimeout = 10 * time.Second
+)
+
+var (
+	podmanSocket = "/run/podman/podman.sock"
+
+	// states of a libpod container
+	containerStates = []string{"created", "running", "paused", "stopped", "exited"}
+
+	client *http.Client
+)
+
+// listedContainer holds the fields of GET /containers/json used here
+type listedContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+	Image string   `json:"Image"`
+	State string   `json:"State"`
+}
+
+// inspectedContainer holds the fields of GET /containers/{id}/json used here
+type inspectedContainer struct {
+	RestartCount int32 `json:"RestartCount"`
+}
+
+// statsReport holds the fields of GET /containers/stats used here
+type statsReport struct {
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"Error"`
+	Stats []struct {
+		ContainerID string `json:"ContainerID"`
+		CPUNano     uint64 `json:"CPUNano"`
+		MemUsage    uint64 `json:"MemUsage"`
+		MemLimit    uint64 `json:"MemLimit"`
+		NetInput    uint64 `json:"NetInput"`
+		NetOutput   uint64 `json:"NetOutput"`
+		PIDs        uint64 `json:"PIDs"`
+	} `json:"Stats"`
+}
+
+// containerStats holds the state and resource usage of a container
+type containerStats struct {
+	ID             string
+	Name           string
+	Image          string
+	State          string
+	Restarts       int32
+	HasUsage       bool
+	CPUSeconds     float64
+	MemoryUsage    uint64
+	MemoryLimit    uint64
+	NetworkReceive uint64
+	NetworkSend    uint64
+	PIDs           uint64
+}
+
+// newClient returns an HTTP client talking to the Podman socket
+func newClient() *http.Client {
+	if socketEnv := os.Getenv("PODMAN_SOCKET"); socketEnv != "" {
+		podmanSocket = socketEnv
+	}
+	socket := podmanSocket
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// getJSON decodes the response of a libpod endpoint into v
+func getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiPrefix+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", endpoint, response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", endpoint, err)
+	}
+	return nil
+}
+
+// readContainerStats lists every container along with the resource usage of
+// running ones
+func readContainerStats(ctx context.Context) ([]containerStats, error) {
+	var listed []listedContainer
+	if err := getJSON(ctx, "/containers/json?all=true", &listed); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	containers := make([]containerStats, 0, len(listed))
+	index := make(map[string]int)
+	running := url.Values{"stream": {"false"}}
+	for _, c := range listed {
+		stats := containerStats{
+			ID:    c.ID,
+			Image: c.Image,
+			State: c.State,
+		}
+		if len(c.Names) > 0 {
+			stats.Name = c.Names[0]
+		}
+
+		var inspected inspectedContainer
+		if err := getJSON(ctx, fmt.Sprintf("/containers/%s/json", c.ID), &inspected); err == nil {
+			stats.Restarts = inspected.RestartCount
+		} else {
+			// the container may have been removed since it was listed
+			slog.Debug(fmt.Sprint(err))
+		}
+
+		if c.State == "running" {
+			running.Add("containers", c.ID)
+		}
+		index[c.ID] = len(containers)
+		containers = append(containers, stats)
+	}
+
+	if len(running["containers"]) == 0 {
+		return containers, nil
+	}
+
+	var report statsReport
+	if err := getJSON(ctx, "/containers/stats?"+running.Encode(), &report); err != nil {
+		return containers, fmt.Errorf("failed to get container stats: %v", err)
+	}
+	if report.Error != nil {
+		return containers, fmt.Errorf("failed to get container stats: %s", report.Error.Message)
+	}
+	for _, s := range report.Stats {
+		i, exists := index[s.ContainerID]
+		if !exists {
+			continue
+		}
+		containers[i].HasUsage = true
+		containers[i].CPUSeconds = float64(s.CPUNano) / 1e9
+		containers[i].MemoryUsage = s.MemUsage
+		containers[i].MemoryLimit = s.MemLimit
+		containers[i].NetworkReceive = s.NetInput
+		containers[i].NetworkSend = s.NetOutput
+		containers[i].PIDs = s.PIDs
+	}
+	return containers, nil
+}
+
+// RegisterContainerMetrics registers container metrics and checks the Podman
+// API is reachable. It returns false if the collector is disabled or the
+// socket can't be reached, in which case the collector must not be started.
+func RegisterContainerMetrics(mc *collector.MetriclyCollector, containers config.ContainersConfig) bool {
+	if !containers.Enabled {
+		return false
+	}
+
+	client = newClient()
+	response, err := client.Get(apiPrefix + "/_ping")
+	if err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			err = fmt.Errorf("ping returned %s", response.Status)
+		}
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("disabling container collector, Podman API at %s is unreachable: %v", podmanSocket, err))
+		return false
+	}
+
+	labels := []string{"name", "id", "image"}
+	mc.AddMetric("container_state", "1 for the current state of the container, 0 for others", append(labels, "state"))
+	mc.AddMetric("container_restarts_total", "Number of times the container was restarted", labels)
+	mc.AddMetric("container_cpu_seconds_total", "CPU time consumed by the container", labels)
+	mc.AddMetric("container_memory_usage_bytes", "Memory used by the container", labels)
+	mc.AddMetric("container_memory_limit_bytes", "Memory limit of the container", labels)
+	mc.AddMetric("container_network_receive_bytes_total", "Bytes received by the container", labels)
+	mc.AddMetric("container_network_transmit_bytes_total", "Bytes sent by the container", labels)
+	mc.AddMetric("container_pids", "Number of processes running in the container", labels)
+	return true
+}
+
+// ReportContainerStats reports state and resource usage of containers.
+func ReportContainerStats(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	containers, err := readContainerStats(ctx)
+	if err != nil {
+		if containers == nil {
+			return err
+		}
+		// containers which could be read are still reported
+		slog.Warn(fmt.Sprint(err))
+	}
+
+	series := make(map[string][]collector.Series)
+	add := func(metric string, value float64, labels []string) {
+		series[metric] = append(series[metric], collector.Series{Value: value, Labels: labels})
+	}
+	for _, c := range containers {
+		labels := []string{c.Name, shortID(c.ID), c.Image}
+		for _, state := range containerStates {
+			value := 0.0
+			if c.State == state {
+				value = 1
+			}
+			add("container_state", value, append(labels, state))
+		}
+		add("container_restarts_total", float64(c.Restarts), labels)
+
+		if !c.HasUsage {
+			continue
+		}
+		add("container_cpu_seconds_total", c.CPUSeconds, labels)
+		add("container_memory_usage_bytes", float64(c.MemoryUsage), labels)
+		add("container_memory_limit_bytes", float64(c.MemoryLimit), labels)
+		add("container_network_receive_bytes_total", float64(c.NetworkReceive), labels)
+		add("container_network_transmit_bytes_total", float64(c.NetworkSend), labels)
+		add("container_pids", float64(c.PIDs), labels)
+	}
+	for _, metric := range []string{
+		"container_state",
+		"container_restarts_total",
+		"container_cpu_seconds_total",
+		"container_memory_usage_bytes",
+		"container_memory_limit_bytes",
+		"container_network_receive_bytes_total",
+		"container_network_transmit_bytes_total",
+		"container_pids",
+	} {
+		// removed containers must not be reported anymore
+		mc.ReplaceMetric(metric, series[metric])
+	}
+
+	slog.Info(fmt.Sprintf("Collected Container metrics in %s", time.Since(start)))
+	return nil
+}
+
+// shortID truncates a container ID the way podman ps displays it
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,107 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	metriclyID    = "3f1c2a9b8e7d6c5b4a39281706f5e4d3c2b1a09f8e7d6c5b4a39281706f5e4d3"
+	prometheusID  = "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b"
+	containersRaw = `[
+  {"Id": "` + metriclyID + `", "Names": ["metricly_metricly"], "Image": "localhost/metricly:latest", "State": "running"},
+  {"Id": "` + prometheusID + `", "Names": ["metricly_prometheus"], "Image": "quay.io/prometheus/prometheus:v2.36.2", "State": "exited"}
+]`
+	statsRaw = `{"Error": null, "Stats": [
+  {"ContainerID": "` + metriclyID + `", "Name": "metricly_metricly", "CPUNano": 2500000000, "MemUsage": 20971520, "MemLimit": 1073741824, "NetInput": 1024, "NetOutput": 2048, "PIDs": 7}
+]}`
+)
+
+// startFakePodman serves the libpod endpoints used by the pollster on a
+// unix socket
+func startFakePodman(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v4.0.0/libpod/_ping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	})
+	mux.HandleFunc("/v4.0.0/libpod/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "true" {
+			t.Errorf("expected every container to be listed")
+		}
+		fmt.Fprint(w, containersRaw)
+	})
+	mux.HandleFunc("/v4.0.0/libpod/containers/stats", func(w http.ResponseWriter, r *http.Request) {
+		if ids := r.URL.Query()["containers"]; len(ids) != 1 || ids[0] != metriclyID {
+			t.Errorf("expected stats of running containers only, got %v", ids)
+		}
+		fmt.Fprint(w, statsRaw)
+	})
+	mux.HandleFunc("/v4.0.0/libpod/containers/"+metriclyID+"/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"RestartCount": 0}`)
+	})
+	mux.HandleFunc("/v4.0.0/libpod/containers/"+prometheusID+"/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"RestartCount": 3}`)
+	})
+
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return socket
+}
+
+func TestReportContainerStats(t *testing.T) {
+	t.Setenv("PODMAN_SOCKET", startFakePodman(t))
+
+	mc := collector.CreateMetricCollector()
+	if !RegisterContainerMetrics(mc, config.ContainersConfig{Enabled: true}) {
+		t.Fatalf("expected container collector to be enabled")
+	}
+
+	ReportContainerStats(context.Background(), mc)
+
+	metricly := "metricly_metricly|3f1c2a9b8e7d|localhost/metricly:latest"
+	prometheus := "metricly_prometheus|9a8b7c6d5e4f|quay.io/prometheus/prometheus:v2.36.2"
+
+	helper.VerifyMetric(t, mc, "metricly_container_state|"+metricly+"|running", 1)
+	helper.VerifyMetric(t, mc, "metricly_container_state|"+metricly+"|exited", 0)
+	helper.VerifyMetric(t, mc, "metricly_container_state|"+prometheus+"|exited", 1)
+	helper.VerifyMetric(t, mc, "metricly_container_restarts_total|"+prometheus, 3)
+	helper.VerifyMetric(t, mc, "metricly_container_cpu_seconds_total|"+metricly, 2.5)
+	helper.VerifyMetric(t, mc, "metricly_container_memory_usage_bytes|"+metricly, 20971520)
+	helper.VerifyMetric(t, mc, "metricly_container_memory_limit_bytes|"+metricly, 1073741824)
+	helper.VerifyMetric(t, mc, "metricly_container_network_receive_bytes_total|"+metricly, 1024)
+	helper.VerifyMetric(t, mc, "metricly_container_network_transmit_bytes_total|"+metricly, 2048)
+	helper.VerifyMetric(t, mc, "metricly_container_pids|"+metricly, 7)
+
+	if _, exists := mc.Data["metricly_container_cpu_seconds_total|"+prometheus]; exists {
+		t.Errorf("expected no usage for stopped containers")
+	}
+}
+
+func TestRegisterContainerMetricsDisabled(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+
+	if RegisterContainerMetrics(mc, config.ContainersConfig{Enabled: false}) {
+		t.Errorf("expected container collector to be disabled by default")
+	}
+
+	t.Setenv("PODMAN_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	if RegisterContainerMetrics(mc, config.ContainersConfig{Enabled: true}) {
+		t.Errorf("expected unreachable socket to disable container collector")
+	}
+}
@@ -2,6 +2,7 @@ package cpu
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	collector "metricly/internal/collector"
@@ -138,17 +139,21 @@ func RegisterCPUMetrics(mc *collector.MetriclyCollector) {
 }
 
 // collectCPUUsage collects the CPU usage as a percentage over a defined time interval.
-func ReportCpuUsage(mc *collector.MetriclyCollector) {
+func ReportCpuUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
 
 	if reflect.DeepEqual(prevCPU, cpuUsage{}) {
 		// Capture initial CPU stats
-		prevCPU, _ = readCPUStats()
-		return
+		var err error
+		prevCPU, err = readCPUStats()
+		return err
 	}
 	start := time.Now()
 
 	// Capture current CPU stats
-	currCPU, _ := readCPUStats()
+	currCPU, err := readCPUStats()
+	if err != nil {
+		return err
+	}
 
 	mc.UpdateMetric("cpu_total", calculateTotalUsage(prevCPU, currCPU), []string{})
 	mc.UpdateMetric("cpu_user", calculateUserUsage(prevCPU, currCPU), []string{})
@@ -156,4 +161,5 @@ func ReportCpuUsage(mc *collector.MetriclyCollector) {
 	mc.UpdateMetric("cpu_steal", calculateStealUsage(prevCPU, currCPU), []string{})
 
 	slog.Info(fmt.Sprintf("Collected CPU metrics in %s", time.Since(start)))
+	return nil
 }
@@ -1,6 +1,7 @@
 package cpu
 
 import (
+	"context"
 	collector "metricly/internal/collector"
 	helper "metricly/internal/pollster/tests"
 	"os"
@@ -119,7 +120,7 @@ cpu0 100 150 200 250 30 35 40 45 50`
 	mc := collector.CreateMetricCollector()
 	RegisterCPUMetrics(mc)
 
-	ReportCpuUsage(mc)
+	ReportCpuUsage(context.Background(), mc)
 
 	helper.VerifyMetric(t, mc, "metricly_cpu_total", 77.27)
 	helper.VerifyMetric(t, mc, "metricly_cpu_system", 22.72)
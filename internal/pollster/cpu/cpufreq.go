@@ -0,0 +1,123 @@
+package cpu
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var (
+	sysDevicesCPU = "/sys/devices/system/cpu"
+	cpuDirPattern = regexp.MustCompile(`^cpu[0-9]+$`)
+)
+
+// cpuFreqStats holds frequency and throttling counters of a single core
+type cpuFreqStats struct {
+	CPU                  string
+	CurrentHz            uint64
+	MinHz                uint64
+	MaxHz                uint64
+	HasThrottle          bool
+	CoreThrottleCount    uint64
+	PackageThrottleCount uint64
+}
+
+// readKHzValue reads cpufreq files, which report frequencies in kHz, as Hz
+func readKHzValue(path string) (uint64, error) {
+	value, err := common.ReadSysfsValue(path)
+	if err != nil {
+		return 0, err
+	}
+	return common.ParseUint(value) * 1000, nil
+}
+
+// readCPUFreqStats reads per core frequency and thermal throttle counters
+// from /sys/devices/system/cpu/cpu*/
+func readCPUFreqStats() ([]cpuFreqStats, error) {
+
+	if sysDevicesCPUEnv := os.Getenv("SYS_DEVICES_CPU"); sysDevicesCPUEnv != "" {
+		sysDevicesCPU = sysDevicesCPUEnv
+	}
+
+	entries, err := os.ReadDir(sysDevicesCPU)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", sysDevicesCPU, err)
+	}
+
+	var stats []cpuFreqStats
+	for _, entry := range entries {
+		if !cpuDirPattern.MatchString(entry.Name()) {
+			continue
+		}
+		cpuPath := filepath.Join(sysDevicesCPU, entry.Name())
+		core := cpuFreqStats{CPU: entry.Name()}
+
+		// scaling_cur_freq is readable by everyone, cpuinfo_cur_freq needs root
+		core.CurrentHz, err = readKHzValue(filepath.Join(cpuPath, "cpufreq", "scaling_cur_freq"))
+		if err != nil {
+			core.CurrentHz, err = readKHzValue(filepath.Join(cpuPath, "cpufreq", "cpuinfo_cur_freq"))
+		}
+		if err != nil {
+			// cpufreq is unavailable for offline cores and on most VMs
+			slog.Debug(fmt.Sprintf("skipping frequency of %s: %v", entry.Name(), err))
+		}
+		core.MinHz, _ = readKHzValue(filepath.Join(cpuPath, "cpufreq", "cpuinfo_min_freq"))
+		core.MaxHz, _ = readKHzValue(filepath.Join(cpuPath, "cpufreq", "cpuinfo_max_freq"))
+
+		if value, err := common.ReadSysfsValue(filepath.Join(cpuPath, "thermal_throttle", "core_throttle_count")); err == nil {
+			core.HasThrottle = true
+			core.CoreThrottleCount = common.ParseUint(value)
+		}
+		if value, err := common.ReadSysfsValue(filepath.Join(cpuPath, "thermal_throttle", "package_throttle_count")); err == nil {
+			core.HasThrottle = true
+			core.PackageThrottleCount = common.ParseUint(value)
+		}
+
+		stats = append(stats, core)
+	}
+
+	return stats, nil
+}
+
+func RegisterCPUFreqMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("cpu_frequency_hertz", "Current CPU core frequency in hertz", []string{"cpu"})
+	mc.AddMetric("cpu_frequency_min_hertz", "Minimum CPU core frequency in hertz", []string{"cpu"})
+	mc.AddMetric("cpu_frequency_max_hertz", "Maximum CPU core frequency in hertz", []string{"cpu"})
+	mc.AddMetric("cpu_core_throttles_total", "Number of times the core was thermally throttled", []string{"cpu"})
+	mc.AddMetric("cpu_package_throttles_total", "Number of times the package of the core was thermally throttled", []string{"cpu"})
+}
+
+// ReportCPUFreq reports per core frequencies and thermal throttle counters.
+func ReportCPUFreq(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	stats, err := readCPUFreqStats()
+	if err != nil {
+		return err
+	}
+
+	for _, core := range stats {
+		if core.CurrentHz != 0 {
+			mc.UpdateMetric("cpu_frequency_hertz", float64(core.CurrentHz), []string{core.CPU})
+		}
+		if core.MinHz != 0 {
+			mc.UpdateMetric("cpu_frequency_min_hertz", float64(core.MinHz), []string{core.CPU})
+		}
+		if core.MaxHz != 0 {
+			mc.UpdateMetric("cpu_frequency_max_hertz", float64(core.MaxHz), []string{core.CPU})
+		}
+		if core.HasThrottle {
+			mc.UpdateMetric("cpu_core_throttles_total", float64(core.CoreThrottleCount), []string{core.CPU})
+			mc.UpdateMetric("cpu_package_throttles_total", float64(core.PackageThrottleCount), []string{core.CPU})
+		}
+	}
+
+	slog.Info(fmt.Sprintf("Collected CPU frequency metrics in %s", time.Since(start)))
+	return nil
+}
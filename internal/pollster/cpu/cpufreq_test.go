@@ -0,0 +1,64 @@
+package cpu
+
+import (
+	"context"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"testing"
+)
+
+func TestReadCPUFreqStats(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"cpu0/cpufreq/scaling_cur_freq":                "2400000\n",
+		"cpu0/cpufreq/cpuinfo_min_freq":                "800000\n",
+		"cpu0/cpufreq/cpuinfo_max_freq":                "4200000\n",
+		"cpu0/thermal_throttle/core_throttle_count":    "3\n",
+		"cpu0/thermal_throttle/package_throttle_count": "7\n",
+		"cpu1/cpufreq/scaling_cur_freq":                "3100000\n",
+		"cpufreq/boost":                                "1\n",
+		"online":                                       "0-1\n",
+	})
+	tmpSrc := sysDevicesCPU
+	defer func() { sysDevicesCPU = tmpSrc }()
+	sysDevicesCPU = root
+
+	stats, err := readCPUFreqStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 cores, got %d", len(stats))
+	}
+
+	if stats[0].CurrentHz != 2400000000 {
+		t.Errorf("expected CurrentHz=2400000000, got %d", stats[0].CurrentHz)
+	}
+	if stats[0].MinHz != 800000000 || stats[0].MaxHz != 4200000000 {
+		t.Errorf("unexpected min/max frequency: %d/%d", stats[0].MinHz, stats[0].MaxHz)
+	}
+	if !stats[0].HasThrottle || stats[0].CoreThrottleCount != 3 || stats[0].PackageThrottleCount != 7 {
+		t.Errorf("unexpected throttle counters: %+v", stats[0])
+	}
+	if stats[1].HasThrottle {
+		t.Errorf("expected no throttle counters for cpu1")
+	}
+}
+
+func TestReportCPUFreq(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"cpu0/cpufreq/scaling_cur_freq":             "2400000\n",
+		"cpu0/thermal_throttle/core_throttle_count": "3\n",
+	})
+	tmpSrc := sysDevicesCPU
+	defer func() { sysDevicesCPU = tmpSrc }()
+	sysDevicesCPU = root
+
+	mc := collector.CreateMetricCollector()
+	RegisterCPUFreqMetrics(mc)
+
+	ReportCPUFreq(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_cpu_frequency_hertz|cpu0", 2400000000)
+	helper.VerifyMetric(t, mc, "metricly_cpu_core_throttles_total|cpu0", 3)
+	helper.VerifyMetric(t, mc, "metricly_cpu_package_throttles_total|cpu0", 0)
+}
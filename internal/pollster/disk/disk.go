@@ -2,6 +2,7 @@ package disk
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	collector "metricly/internal/collector"
@@ -206,13 +207,12 @@ func RegisterDiskMetrics(mc *collector.MetriclyCollector) {
 }
 
 // ReportDiskMetrics reports disk metrics periodically.
-func ReportDiskUsage(mc *collector.MetriclyCollector) {
+func ReportDiskUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
 	start := time.Now()
 	// get disk I/O usage
 	diskStatsMap, err := parseDiskStats()
 	if err != nil {
-		fmt.Printf("Error reading disk stats: %v\n", err)
-		return
+		return fmt.Errorf("failed to read disk stats: %v", err)
 	}
 
 	for device, stats := range diskStatsMap {
@@ -262,14 +262,12 @@ func ReportDiskUsage(mc *collector.MetriclyCollector) {
 	// get disk space usage
 	mounts, err := getMountPoints()
 	if err != nil {
-		slog.Warn(fmt.Sprintf("failed to retrieve disk mounts: %s", err))
-		return
+		return fmt.Errorf("failed to retrieve disk mounts: %s", err)
 	}
 
 	diskSpaceStats, err := readDiskSpaceStats(mounts)
 	if err != nil {
-		slog.Warn(fmt.Sprintf("failed to retrieve disk stats: %s", err))
-		return
+		return fmt.Errorf("failed to retrieve disk stats: %s", err)
 	}
 	for mount, stats := range diskSpaceStats {
 		mc.UpdateMetric(
@@ -294,4 +292,5 @@ func ReportDiskUsage(mc *collector.MetriclyCollector) {
 		)
 	}
 	slog.Info(fmt.Sprintf("Collected Disk metrics in %s", time.Since(start)))
+	return nil
 }
@@ -1,6 +1,7 @@
 package disk
 
 import (
+	"context"
 	pollster "metricly/internal/collector"
 	helper "metricly/internal/pollster/tests"
 	"os"
@@ -81,7 +82,7 @@ func TestParseDiskStats(t *testing.T) {
 
 	mc := pollster.CreateMetricCollector()
 	RegisterDiskMetrics(mc)
-	ReportDiskUsage(mc)
+	ReportDiskUsage(context.Background(), mc)
 
 	helper.VerifyMetric(t, mc, "metricly_disk_reads_completed_total|sda", 157698)
 	helper.VerifyMetric(t, mc, "metricly_disk_io_in_progress|sda1", 0)
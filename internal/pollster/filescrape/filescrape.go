@@ -0,0 +1,272 @@
+package filescrape
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	typeGauge   = "gauge"
+	typeCounter = "counter"
+	valueGroup  = "value"
+	pathLabel   = "path"
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// rules validated by RegisterFileScrapeMetrics
+	scrapeRules []rule
+)
+
+// rule is a compiled FileScrapeConfig
+type rule struct {
+	Name      string
+	Metric    string
+	Path      string
+	Regex     *regexp.Regexp
+	ValueType prometheus.ValueType
+	Desc      *prometheus.Desc
+	Scale     float64
+	// set if Path is a glob, so every matched file gets its own series
+	WithPath bool
+}
+
+// metricName builds the exported name out of the rule name, unit and type
+// following Prometheus naming conventions
+func metricName(scrape config.FileScrapeConfig) string {
+	name := "metricly_" + scrape.Name
+	if scrape.Unit != "" && !strings.HasSuffix(name, "_"+scrape.Unit) {
+		name += "_" + scrape.Unit
+	}
+	if scrape.Type == typeCounter && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	return name
+}
+
+// compileRule validates a rule and prepares its regex and descriptor
+func compileRule(scrape config.FileScrapeConfig) (rule, error) {
+	if !validName.MatchString(scrape.Name) {
+		return rule{}, fmt.Errorf("invalid metric name %q", scrape.Name)
+	}
+	if scrape.Unit != "" && !validName.MatchString(scrape.Unit) {
+		return rule{}, fmt.Errorf("invalid unit %q", scrape.Unit)
+	}
+	if scrape.Path == "" {
+		return rule{}, fmt.Errorf("path is required")
+	}
+	if _, err := filepath.Match(scrape.Path, ""); err != nil {
+		return rule{}, fmt.Errorf("invalid path glob %q: %v", scrape.Path, err)
+	}
+
+	regex, err := regexp.Compile(scrape.Regex)
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid regex: %v", err)
+	}
+
+	var (
+		labels   []string
+		hasValue bool
+	)
+	withPath := strings.ContainsAny(scrape.Path, "*?[")
+	if withPath {
+		labels = append(labels, pathLabel)
+	}
+	for _, group := range regex.SubexpNames() {
+		switch {
+		case group == "":
+			continue
+		case group == valueGroup:
+			hasValue = true
+		case group == pathLabel && withPath, group == "hostname":
+			return rule{}, fmt.Errorf("capture group %q clashes with a reserved label", group)
+		case !validName.MatchString(group):
+			return rule{}, fmt.Errorf("capture group %q is not a valid label name", group)
+		default:
+			labels = append(labels, group)
+		}
+	}
+	if !hasValue {
+		return rule{}, fmt.Errorf("regex has no %q capture group", valueGroup)
+	}
+
+	valueType := prometheus.GaugeValue
+	switch scrape.Type {
+	case "", typeGauge:
+	case typeCounter:
+		valueType = prometheus.CounterValue
+	default:
+		return rule{}, fmt.Errorf("unsupported type %q", scrape.Type)
+	}
+
+	scale := scrape.Scale
+	if scale == 0 {
+		scale = 1
+	}
+
+	help := scrape.Help
+	if help == "" {
+		help = fmt.Sprintf("Value scraped from %s", scrape.Path)
+	}
+
+	name := metricName(scrape)
+	return rule{
+		Name:      scrape.Name,
+		Metric:    name,
+		Path:      scrape.Path,
+		Regex:     regex,
+		ValueType: valueType,
+		Desc:      prometheus.NewDesc(name, help, labels, prometheus.Labels{"hostname": common.GetHostname()}),
+		Scale:     scale,
+		WithPath:  withPath,
+	}, nil
+}
+
+// scrapeFile matches every line of a file and returns label values and
+// values of matching lines. Lines yielding a series that was already seen
+// are ignored.
+func scrapeFile(r rule, path string, seen map[string]bool) ([][]string, []float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var (
+		labelValues [][]string
+		values      []float64
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := r.Regex.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		var (
+			lineLabels []string
+			value      float64
+		)
+		if r.WithPath {
+			lineLabels = append(lineLabels, path)
+		}
+		for i, group := range r.Regex.SubexpNames() {
+			switch group {
+			case "":
+			case valueGroup:
+				value, err = strconv.ParseFloat(match[i], 64)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid value %q in %s", match[i], path)
+				}
+			default:
+				lineLabels = append(lineLabels, match[i])
+			}
+		}
+
+		signature := strings.Join(lineLabels, "\xff")
+		if seen[signature] {
+			slog.Debug(fmt.Sprintf("file scrape %s: ignoring duplicate series %v in %s", r.Name, lineLabels, path))
+			continue
+		}
+		seen[signature] = true
+
+		labelValues = append(labelValues, lineLabels)
+		values = append(values, value*r.Scale)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return labelValues, values, nil
+}
+
+// scrapeRule collects the series of a rule over every matched file
+func scrapeRule(r rule) ([]prometheus.Metric, error) {
+	paths, err := filepath.Glob(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no file matches %s", r.Path)
+	}
+	sort.Strings(paths)
+
+	var metrics []prometheus.Metric
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		labelValues, values, err := scrapeFile(r, path, seen)
+		if err != nil {
+			return nil, err
+		}
+		for i := range values {
+			metric, err := prometheus.NewConstMetric(r.Desc, r.ValueType, values[i], labelValues[i]...)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
+
+// RegisterFileScrapeMetrics registers the scrape status metric and compiles
+// the configured rules, invalid ones are logged and skipped.
+func RegisterFileScrapeMetrics(mc *collector.MetriclyCollector, scrapes []config.FileScrapeConfig) {
+	mc.AddMetric("file_scrape_error", "1 if the files of a rule could not be read or parsed, 0 otherwise", []string{"rule"})
+
+	scrapeRules = nil
+	names := make(map[string]bool)
+	for _, scrape := range scrapes {
+		r, err := compileRule(scrape)
+		if err != nil {
+			slog.Error(fmt.Sprintf("skipping file scrape rule %q: %v", scrape.Name, err))
+			continue
+		}
+		mc.Mutex.Lock()
+		_, builtin := mc.Metrics[r.Metric]
+		mc.Mutex.Unlock()
+		if names[r.Metric] || builtin {
+			slog.Error(fmt.Sprintf("skipping file scrape rule %q: metric %s is already defined", scrape.Name, r.Metric))
+			continue
+		}
+		names[r.Metric] = true
+		scrapeRules = append(scrapeRules, r)
+	}
+}
+
+// ReportFileScrape reports the metrics of every file scrape rule.
+func ReportFileScrape(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	var metrics []prometheus.Metric
+	for _, r := range scrapeRules {
+		scrapeError := 0.0
+		ruleMetrics, err := scrapeRule(r)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("file scrape %s: %v", r.Name, err))
+			scrapeError = 1
+		}
+		metrics = append(metrics, ruleMetrics...)
+		mc.UpdateMetric("file_scrape_error", scrapeError, []string{r.Name})
+	}
+	if err := mc.SetMetrics("file_scrape", metrics); err != nil {
+		return fmt.Errorf("skipping file scrape metrics: %v", err)
+	}
+
+	slog.Info(fmt.Sprintf("Collected File Scrape metrics in %s", time.Since(start)))
+	return nil
+}
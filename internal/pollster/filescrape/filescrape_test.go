@@ -0,0 +1,123 @@
+package filescrape
+
+import (
+	"context"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var pressureCPU = `some avg10=1.50 avg60=0.80 avg300=0.20 total=2500000
+full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+`
+
+var snmpUdp = `Udp: InDatagrams NoPorts InErrors OutDatagrams
+Udp: 1200 3 7 1100
+`
+
+func TestCompileRule(t *testing.T) {
+	r, err := compileRule(config.FileScrapeConfig{
+		Name:  "pressure_cpu_stalled",
+		Path:  "/proc/pressure/cpu",
+		Regex: `^(?P<kind>some|full) .*total=(?P<value>[0-9]+)$`,
+		Type:  "counter",
+		Unit:  "seconds",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Metric != "metricly_pressure_cpu_stalled_seconds_total" {
+		t.Errorf("unexpected metric name %s", r.Metric)
+	}
+	if r.Scale != 1 {
+		t.Errorf("expected default scale 1, got %f", r.Scale)
+	}
+
+	invalid := []config.FileScrapeConfig{
+		{Name: "no_value", Path: "/proc/loadavg", Regex: `^(\S+)`},
+		{Name: "bad-name", Path: "/proc/loadavg", Regex: `^(?P<value>\S+)`},
+		{Name: "bad_type", Path: "/proc/loadavg", Regex: `^(?P<value>\S+)`, Type: "histogram"},
+		{Name: "bad_regex", Path: "/proc/loadavg", Regex: `^(?P<value>\S+`},
+		{Name: "reserved", Path: "/proc/loadavg", Regex: `^(?P<hostname>\S+) (?P<value>\S+)`},
+		{Name: "no_path", Regex: `^(?P<value>\S+)`},
+	}
+	for _, scrape := range invalid {
+		if _, err := compileRule(scrape); err == nil {
+			t.Errorf("expected rule %s to be rejected", scrape.Name)
+		}
+	}
+}
+
+func TestReportFileScrape(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"proc/pressure/cpu":      pressureCPU,
+		"proc/net/snmp":          snmpUdp,
+		"sys/block/sda/size":     "1000\n",
+		"sys/block/nvme0n1/size": "2000\n",
+	})
+
+	mc := collector.CreateMetricCollector()
+	RegisterFileScrapeMetrics(mc, []config.FileScrapeConfig{
+		{
+			Name:  "pressure_cpu_stalled",
+			Path:  filepath.Join(root, "proc/pressure/cpu"),
+			Regex: `^(?P<kind>some|full) .*total=(?P<value>[0-9]+)$`,
+			Type:  "counter",
+			Unit:  "seconds",
+			Scale: 0.000001,
+		},
+		{
+			Name:  "udp_in_errors",
+			Path:  filepath.Join(root, "proc/net/snmp"),
+			Regex: `^Udp: \d+ \d+ (?P<value>\d+)`,
+		},
+		{
+			Name:  "block_size",
+			Path:  filepath.Join(root, "sys/block/*/size"),
+			Regex: `^(?P<value>\d+)$`,
+			Unit:  "bytes",
+			Scale: 512,
+		},
+		{
+			Name:  "missing",
+			Path:  filepath.Join(root, "proc/missing"),
+			Regex: `^(?P<value>\d+)$`,
+		},
+		// rejected as it is defined twice
+		{
+			Name:  "udp_in_errors",
+			Path:  filepath.Join(root, "proc/net/snmp"),
+			Regex: `^Udp: \d+ (?P<value>\d+)`,
+		},
+	})
+	if len(scrapeRules) != 4 {
+		t.Fatalf("expected 4 valid rules, got %d", len(scrapeRules))
+	}
+
+	ReportFileScrape(context.Background(), mc)
+
+	helper.VerifyGatheredMetric(t, mc, "metricly_pressure_cpu_stalled_seconds_total", map[string]string{"kind": "some", "hostname": "testhost"}, 2.5)
+	helper.VerifyGatheredMetric(t, mc, "metricly_pressure_cpu_stalled_seconds_total", map[string]string{"kind": "full"}, 0)
+	helper.VerifyGatheredMetric(t, mc, "metricly_udp_in_errors", map[string]string{}, 7)
+	helper.VerifyGatheredMetric(t, mc, "metricly_block_size_bytes", map[string]string{"path": filepath.Join(root, "sys/block/sda/size")}, 512000)
+	helper.VerifyGatheredMetric(t, mc, "metricly_block_size_bytes", map[string]string{"path": filepath.Join(root, "sys/block/nvme0n1/size")}, 1024000)
+
+	helper.VerifyMetric(t, mc, "metricly_file_scrape_error|pressure_cpu_stalled", 0)
+	helper.VerifyMetric(t, mc, "metricly_file_scrape_error|missing", 1)
+
+	// series of files which disappeared are dropped on the next collection
+	if err := os.Remove(filepath.Join(root, "sys/block/sda/size")); err != nil {
+		t.Fatal(err)
+	}
+	ReportFileScrape(context.Background(), mc)
+
+	families := helper.GatherMetrics(t, mc)
+	if metric := helper.FindGatheredMetric(families, "metricly_block_size_bytes", map[string]string{"path": filepath.Join(root, "sys/block/sda/size")}); metric != nil {
+		t.Errorf("expected series of removed file to be dropped")
+	}
+}
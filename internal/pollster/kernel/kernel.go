@@ -0,0 +1,163 @@
+package kernel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	procSys     = "/proc/sys"
+	procLoadavg = "/proc/loadavg"
+)
+
+// kernelStats holds kernel table usage and their limits
+type kernelStats struct {
+	FileDescriptorsAllocated uint64
+	FileDescriptorsMax       uint64
+	InodesAllocated          uint64
+	InodesFree               uint64
+	PIDMax                   uint64
+	ThreadsMax               uint64
+	Threads                  uint64
+	EntropyAvailable         uint64
+	EntropyPoolSize          uint64
+	HasConntrack             bool
+	ConntrackEntries         uint64
+	ConntrackMax             uint64
+}
+
+// readFields reads a whitespace separated file under /proc/sys and ensures
+// it holds at least count fields
+func readFields(path string, count int) ([]string, error) {
+	content, err := common.ReadSysfsValue(filepath.Join(procSys, path))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(content)
+	if len(fields) < count {
+		return nil, fmt.Errorf("unexpected format in %s", filepath.Join(procSys, path))
+	}
+	return fields, nil
+}
+
+// readKernelStats reads file descriptor, inode, PID, entropy and conntrack
+// tables from /proc/sys
+func readKernelStats() (kernelStats, error) {
+
+	if procSysEnv := os.Getenv("PROC_SYS"); procSysEnv != "" {
+		procSys = procSysEnv
+	}
+	if procLoadavgEnv := os.Getenv("PROC_LOADAVG"); procLoadavgEnv != "" {
+		procLoadavg = procLoadavgEnv
+	}
+
+	var stats kernelStats
+
+	// allocated, allocated but unused (always 0 since 2.6), maximum
+	fileNr, err := readFields("fs/file-nr", 3)
+	if err != nil {
+		return kernelStats{}, err
+	}
+	stats.FileDescriptorsAllocated = common.ParseUint(fileNr[0])
+	stats.FileDescriptorsMax = common.ParseUint(fileNr[2])
+
+	// allocated, free
+	if inodeNr, err := readFields("fs/inode-nr", 2); err == nil {
+		stats.InodesAllocated = common.ParseUint(inodeNr[0])
+		stats.InodesFree = common.ParseUint(inodeNr[1])
+	} else {
+		slog.Warn(fmt.Sprint(err))
+	}
+
+	if pidMax, err := readFields("kernel/pid_max", 1); err == nil {
+		stats.PIDMax = common.ParseUint(pidMax[0])
+	} else {
+		slog.Warn(fmt.Sprint(err))
+	}
+	if threadsMax, err := readFields("kernel/threads-max", 1); err == nil {
+		stats.ThreadsMax = common.ParseUint(threadsMax[0])
+	} else {
+		slog.Warn(fmt.Sprint(err))
+	}
+
+	if entropy, err := readFields("kernel/random/entropy_avail", 1); err == nil {
+		stats.EntropyAvailable = common.ParseUint(entropy[0])
+	} else {
+		slog.Warn(fmt.Sprint(err))
+	}
+	if poolSize, err := readFields("kernel/random/poolsize", 1); err == nil {
+		stats.EntropyPoolSize = common.ParseUint(poolSize[0])
+	}
+
+	// nf_conntrack is only present when the module is loaded
+	conntrackCount, countErr := readFields("net/netfilter/nf_conntrack_count", 1)
+	conntrackMax, maxErr := readFields("net/netfilter/nf_conntrack_max", 1)
+	if countErr == nil && maxErr == nil {
+		stats.HasConntrack = true
+		stats.ConntrackEntries = common.ParseUint(conntrackCount[0])
+		stats.ConntrackMax = common.ParseUint(conntrackMax[0])
+	}
+
+	// the 4th field of /proc/loadavg is runnable/total scheduling entities
+	if loadavg, err := common.ReadSysfsValue(procLoadavg); err == nil {
+		fields := strings.Fields(loadavg)
+		if len(fields) >= 4 {
+			if _, total, found := strings.Cut(fields[3], "/"); found {
+				stats.Threads = common.ParseUint(total)
+			}
+		}
+	} else {
+		slog.Warn(fmt.Sprint(err))
+	}
+
+	return stats, nil
+}
+
+func RegisterKernelMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("kernel_file_descriptors_allocated", "Number of allocated file descriptors", []string{})
+	mc.AddMetric("kernel_file_descriptors_max", "Maximum number of file descriptors", []string{})
+	mc.AddMetric("kernel_inodes_allocated", "Number of allocated inodes", []string{})
+	mc.AddMetric("kernel_inodes_free", "Number of free inodes", []string{})
+	mc.AddMetric("kernel_pid_max", "Maximum PID value", []string{})
+	mc.AddMetric("kernel_threads_max", "Maximum number of threads", []string{})
+	mc.AddMetric("kernel_threads", "Number of threads currently existing", []string{})
+	mc.AddMetric("kernel_entropy_available_bits", "Bits of available entropy", []string{})
+	mc.AddMetric("kernel_entropy_pool_size_bits", "Bits of entropy pool size", []string{})
+	mc.AddMetric("kernel_conntrack_entries", "Number of currently allocated flow entries for connection tracking", []string{})
+	mc.AddMetric("kernel_conntrack_entries_limit", "Maximum size of connection tracking table", []string{})
+}
+
+// ReportKernelUsage reports kernel table usage and limits.
+func ReportKernelUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	stats, err := readKernelStats()
+	if err != nil {
+		return err
+	}
+
+	mc.UpdateMetric("kernel_file_descriptors_allocated", float64(stats.FileDescriptorsAllocated), []string{})
+	mc.UpdateMetric("kernel_file_descriptors_max", float64(stats.FileDescriptorsMax), []string{})
+	mc.UpdateMetric("kernel_inodes_allocated", float64(stats.InodesAllocated), []string{})
+	mc.UpdateMetric("kernel_inodes_free", float64(stats.InodesFree), []string{})
+	mc.UpdateMetric("kernel_pid_max", float64(stats.PIDMax), []string{})
+	mc.UpdateMetric("kernel_threads_max", float64(stats.ThreadsMax), []string{})
+	mc.UpdateMetric("kernel_threads", float64(stats.Threads), []string{})
+	mc.UpdateMetric("kernel_entropy_available_bits", float64(stats.EntropyAvailable), []string{})
+	mc.UpdateMetric("kernel_entropy_pool_size_bits", float64(stats.EntropyPoolSize), []string{})
+
+	if stats.HasConntrack {
+		mc.UpdateMetric("kernel_conntrack_entries", float64(stats.ConntrackEntries), []string{})
+		mc.UpdateMetric("kernel_conntrack_entries_limit", float64(stats.ConntrackMax), []string{})
+	}
+
+	slog.Info(fmt.Sprintf("Collected Kernel metrics in %s", time.Since(start)))
+	return nil
+}
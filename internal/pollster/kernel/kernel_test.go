@@ -0,0 +1,80 @@
+package kernel
+
+import (
+	"context"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"path/filepath"
+	"testing"
+)
+
+func setupKernelSources(t *testing.T, withConntrack bool) {
+	files := map[string]string{
+		"sys/fs/file-nr":                  "9632\t0\t9223372036854775807\n",
+		"sys/fs/inode-nr":                 "412345\t12034\n",
+		"sys/kernel/pid_max":              "4194304\n",
+		"sys/kernel/threads-max":          "254318\n",
+		"sys/kernel/random/entropy_avail": "256\n",
+		"sys/kernel/random/poolsize":      "256\n",
+		"loadavg":                         "0.52 0.58 0.59 2/1834 123456\n",
+	}
+	if withConntrack {
+		files["sys/net/netfilter/nf_conntrack_count"] = "1420\n"
+		files["sys/net/netfilter/nf_conntrack_max"] = "262144\n"
+	}
+	root := helper.SetupSysfsTree(t, files)
+
+	tmpSys, tmpLoadavg := procSys, procLoadavg
+	t.Cleanup(func() {
+		procSys = tmpSys
+		procLoadavg = tmpLoadavg
+	})
+	procSys = filepath.Join(root, "sys")
+	procLoadavg = filepath.Join(root, "loadavg")
+}
+
+func TestReadKernelStats(t *testing.T) {
+	setupKernelSources(t, false)
+
+	stats, err := readKernelStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stats.FileDescriptorsAllocated != 9632 {
+		t.Errorf("expected FileDescriptorsAllocated=9632, got %d", stats.FileDescriptorsAllocated)
+	}
+	if stats.FileDescriptorsMax != 9223372036854775807 {
+		t.Errorf("expected FileDescriptorsMax=9223372036854775807, got %d", stats.FileDescriptorsMax)
+	}
+	if stats.InodesAllocated != 412345 || stats.InodesFree != 12034 {
+		t.Errorf("unexpected inode stats: %d/%d", stats.InodesAllocated, stats.InodesFree)
+	}
+	if stats.PIDMax != 4194304 || stats.ThreadsMax != 254318 {
+		t.Errorf("unexpected pid_max/threads-max: %d/%d", stats.PIDMax, stats.ThreadsMax)
+	}
+	if stats.Threads != 1834 {
+		t.Errorf("expected Threads=1834, got %d", stats.Threads)
+	}
+	if stats.EntropyAvailable != 256 {
+		t.Errorf("expected EntropyAvailable=256, got %d", stats.EntropyAvailable)
+	}
+	if stats.HasConntrack {
+		t.Errorf("expected conntrack to be absent")
+	}
+}
+
+func TestReportKernelUsage(t *testing.T) {
+	setupKernelSources(t, true)
+
+	mc := collector.CreateMetricCollector()
+	RegisterKernelMetrics(mc)
+
+	ReportKernelUsage(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_kernel_file_descriptors_allocated", 9632)
+	helper.VerifyMetric(t, mc, "metricly_kernel_threads", 1834)
+	helper.VerifyMetric(t, mc, "metricly_kernel_pid_max", 4194304)
+	helper.VerifyMetric(t, mc, "metricly_kernel_conntrack_entries", 1420)
+	helper.VerifyMetric(t, mc, "metricly_kernel_conntrack_entries_limit", 262144)
+}
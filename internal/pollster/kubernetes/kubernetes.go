@@ -0,0 +1,246 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sysFsCgroup = "/sys/fs/cgroup"
+
+// containerUsage holds the resource usage of a pod container read from its
+// cgroup interface files
+type containerUsage struct {
+	PodContainer
+	CPUSeconds   float64
+	MemoryUsage  uint64
+	Processes    uint64
+	HasCPU       bool
+	HasMemory    bool
+	HasProcesses bool
+}
+
+// cgroupV1Files lists the hierarchy and file each usage is read from with
+// cgroup v1, which has a hierarchy per controller
+var cgroupV1Files = []struct {
+	Hierarchy string
+	File      string
+	Set       func(usage *containerUsage, value uint64)
+}{
+	{"cpuacct", "cpuacct.usage", func(usage *containerUsage, nsec uint64) {
+		usage.CPUSeconds, usage.HasCPU = float64(nsec)/1e9, true
+	}},
+	{"memory", "memory.usage_in_bytes", func(usage *containerUsage, bytes uint64) {
+		usage.MemoryUsage, usage.HasMemory = bytes, true
+	}},
+	{"pids", "pids.current", func(usage *containerUsage, processes uint64) {
+		usage.Processes, usage.HasProcesses = processes, true
+	}},
+}
+
+// readUint reads a cgroup file holding a single number
+func readUint(path string) (uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// readCPUUsage reads usage_usec out of cpu.stat
+func readCPUUsage(path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			usec, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return float64(usec) / 1e6, nil
+		}
+	}
+	return 0, fmt.Errorf("usage_usec not found in %s", path)
+}
+
+// walkPodCgroups calls read for every cgroup of a known pod container found
+// under the kubepods cgroups of a hierarchy
+func walkPodCgroups(ctx context.Context, root string, read func(path string, pod PodContainer)) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// cgroups are removed while walking
+			if path != root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(root, path)
+		if relPath == "." {
+			return nil
+		}
+		// pods only live under kubepods, kubepods.slice with systemd
+		if !strings.HasPrefix(relPath, "kubepods") {
+			return filepath.SkipDir
+		}
+
+		podUID, containerID := parseCgroupPath("/" + relPath)
+		if containerID == "" {
+			return nil
+		}
+		pod, found := resolver.lookup(ctx, podUID, containerID)
+		if !found {
+			slog.Debug(fmt.Sprintf("no pod container found for cgroup %s", relPath))
+			return filepath.SkipDir
+		}
+		read(path, pod)
+		return filepath.SkipDir
+	})
+}
+
+// readContainerUsage reads the usage of pod containers out of their cgroups,
+// from the unified hierarchy with cgroup v2 or from the cpuacct, memory and
+// pids hierarchies with cgroup v1
+func readContainerUsage(ctx context.Context) ([]containerUsage, error) {
+	if sysFsCgroupEnv := os.Getenv("SYS_FS_CGROUP"); sysFsCgroupEnv != "" {
+		sysFsCgroup = sysFsCgroupEnv
+	}
+
+	var usages []*containerUsage
+	byPod := make(map[PodContainer]*containerUsage)
+	usageOf := func(pod PodContainer) *containerUsage {
+		if usage, exists := byPod[pod]; exists {
+			return usage
+		}
+		usage := &containerUsage{PodContainer: pod}
+		byPod[pod] = usage
+		usages = append(usages, usage)
+		return usage
+	}
+
+	if _, err := os.Stat(filepath.Join(sysFsCgroup, "cgroup.controllers")); err == nil {
+		err := walkPodCgroups(ctx, sysFsCgroup, func(path string, pod PodContainer) {
+			usage := usageOf(pod)
+			if cpu, err := readCPUUsage(filepath.Join(path, "cpu.stat")); err == nil {
+				usage.CPUSeconds, usage.HasCPU = cpu, true
+			}
+			if memory, err := readUint(filepath.Join(path, "memory.current")); err == nil {
+				usage.MemoryUsage, usage.HasMemory = memory, true
+			}
+			if processes, err := readUint(filepath.Join(path, "pids.current")); err == nil {
+				usage.Processes, usage.HasProcesses = processes, true
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk cgroups at %s: %v", sysFsCgroup, err)
+		}
+	} else {
+		for _, v1 := range cgroupV1Files {
+			// cpuacct is usually a symlink to cpu,cpuacct
+			root, err := filepath.EvalSymlinks(filepath.Join(sysFsCgroup, v1.Hierarchy))
+			if err != nil {
+				slog.Debug(fmt.Sprintf("skipping cgroup v1 hierarchy %s: %v", v1.Hierarchy, err))
+				continue
+			}
+			err = walkPodCgroups(ctx, root, func(path string, pod PodContainer) {
+				if value, err := readUint(filepath.Join(path, v1.File)); err == nil {
+					v1.Set(usageOf(pod), value)
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk cgroups at %s: %v", root, err)
+			}
+		}
+	}
+
+	result := make([]containerUsage, len(usages))
+	for i, usage := range usages {
+		result[i] = *usage
+	}
+	return result, nil
+}
+
+// RegisterKubernetesMetrics registers pod container metrics and sets up the
+// kubelet client used to resolve cgroups and processes to pods. It returns
+// false if the collector is disabled or misconfigured, in which case the
+// collector must not be started.
+func RegisterKubernetesMetrics(mc *collector.MetriclyCollector, kubernetes config.KubernetesConfig) bool {
+	resolver = nil
+	if !kubernetes.Enabled {
+		return false
+	}
+	podResolver, err := newResolver(kubernetes)
+	if err != nil {
+		slog.Error(fmt.Sprintf("disabling kubernetes collector: %v", err))
+		return false
+	}
+	resolver = podResolver
+
+	labels := []string{"namespace", "pod", "container"}
+	mc.AddMetric("kubernetes_kubelet_up", "1 if the last pod list request to the kubelet succeeded, 0 otherwise", []string{})
+	mc.AddMetric("kubernetes_container_cpu_seconds_total", "CPU time consumed by the pod container", labels)
+	mc.AddMetric("kubernetes_container_memory_usage_bytes", "Memory used by the pod container", labels)
+	mc.AddMetric("kubernetes_container_processes", "Number of processes running in the pod container", labels)
+	return true
+}
+
+// ReportKubernetesPods reports resource usage of pod containers, labelled
+// with their pod, namespace and container names.
+func ReportKubernetesPods(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	up := 1.0
+	// the previous pod list is still used to resolve cgroups
+	kubeletErr := resolver.ensureFresh(ctx)
+	if kubeletErr != nil {
+		up = 0
+	}
+	mc.UpdateMetric("kubernetes_kubelet_up", up, []string{})
+
+	usages, err := readContainerUsage(ctx)
+	if err != nil {
+		return errors.Join(kubeletErr, err)
+	}
+
+	var cpu, memory, processes []collector.Series
+	for _, usage := range usages {
+		labels := []string{usage.Namespace, usage.Pod, usage.Container}
+		if usage.HasCPU {
+			cpu = append(cpu, collector.Series{Value: usage.CPUSeconds, Labels: labels})
+		}
+		if usage.HasMemory {
+			memory = append(memory, collector.Series{Value: float64(usage.MemoryUsage), Labels: labels})
+		}
+		if usage.HasProcesses {
+			processes = append(processes, collector.Series{Value: float64(usage.Processes), Labels: labels})
+		}
+	}
+	// removed pods must not be reported anymore
+	mc.ReplaceMetric("kubernetes_container_cpu_seconds_total", cpu)
+	mc.ReplaceMetric("kubernetes_container_memory_usage_bytes", memory)
+	mc.ReplaceMetric("kubernetes_container_processes", processes)
+
+	slog.Info(fmt.Sprintf("Collected Kubernetes metrics in %s", time.Since(start)))
+	return kubeletErr
+}
@@ -0,0 +1,236 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	webPodUID   = "6f1a2b3c-4d5e-4f60-8a7b-9c0d1e2f3a4b"
+	dnsPodUID   = "0a1b2c3d-4e5f-4a6b-8c7d-8e9f0a1b2c3d"
+	nginxID     = "1111111111111111111111111111111111111111111111111111111111111111"
+	sidecarID   = "2222222222222222222222222222222222222222222222222222222222222222"
+	corednsID   = "3333333333333333333333333333333333333333333333333333333333333333"
+	unknownID   = "4444444444444444444444444444444444444444444444444444444444444444"
+	testToken   = "test-token"
+	fakePodList = `{
+	"kind": "PodList",
+	"items": [
+		{
+			"metadata": {"name": "web-7d9c", "namespace": "shop", "uid": "` + webPodUID + `"},
+			"status": {
+				"containerStatuses": [
+					{"name": "nginx", "containerID": "containerd://` + nginxID + `"},
+					{"name": "sidecar", "containerID": "containerd://` + sidecarID + `"},
+					{"name": "pending"}
+				]
+			}
+		},
+		{
+			"metadata": {"name": "coredns-5d78", "namespace": "kube-system", "uid": "` + dnsPodUID + `"},
+			"status": {
+				"containerStatuses": [
+					{"name": "coredns", "containerID": "cri-o://` + corednsID + `"}
+				]
+			}
+		}
+	]
+}`
+)
+
+// startFakeKubelet serves the kubelet /pods endpoint, rejecting requests
+// without the test token
+func startFakeKubelet(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/pods" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, fakePodList)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// setupResolver enables the collector against a fake kubelet
+func setupResolver(t *testing.T, mc *collector.MetriclyCollector) *atomic.Int32 {
+	server, requests := startFakeKubelet(t)
+	token := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(token, []byte(testToken+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if !RegisterKubernetesMetrics(mc, config.KubernetesConfig{
+		Enabled:    true,
+		KubeletURL: server.URL,
+		TokenFile:  token,
+	}) {
+		t.Fatalf("expected kubernetes collector to be enabled")
+	}
+	t.Cleanup(func() { resolver = nil })
+	return requests
+}
+
+func TestParseCgroupPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		podUID      string
+		containerID string
+	}{
+		{
+			path:        "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + strings.ReplaceAll(webPodUID, "-", "_") + ".slice/cri-containerd-" + nginxID + ".scope",
+			podUID:      webPodUID,
+			containerID: nginxID,
+		},
+		{
+			path:        "/kubepods.slice/kubepods-pod" + strings.ReplaceAll(dnsPodUID, "-", "_") + ".slice/crio-" + corednsID + ".scope",
+			podUID:      dnsPodUID,
+			containerID: corednsID,
+		},
+		{
+			path:        "/kubepods/besteffort/pod" + webPodUID + "/" + sidecarID,
+			podUID:      webPodUID,
+			containerID: sidecarID,
+		},
+		{
+			path:   "/kubepods/burstable/pod" + webPodUID,
+			podUID: webPodUID,
+		},
+		{
+			path:   "/kubepods.slice/kubepods-pod" + strings.ReplaceAll(dnsPodUID, "-", "_") + ".slice/crio-conmon-" + corednsID + ".scope",
+			podUID: dnsPodUID,
+		},
+		{path: "/system.slice/sshd.service"},
+	}
+
+	for _, test := range tests {
+		podUID, containerID := parseCgroupPath(test.path)
+		if podUID != test.podUID || containerID != test.containerID {
+			t.Errorf("%s: expected %q %q, got %q %q", test.path, test.podUID, test.containerID, podUID, containerID)
+		}
+	}
+}
+
+func TestResolveCgroup(t *testing.T) {
+	if _, found := resolveCgroup(context.Background(), "/kubepods/burstable/pod"+webPodUID+"/"+nginxID); found {
+		t.Errorf("expected nothing to be resolved while disabled")
+	}
+
+	mc := collector.CreateMetricCollector()
+	requests := setupResolver(t, mc)
+
+	pod, found := resolveCgroup(context.Background(), "/kubepods/burstable/pod"+webPodUID+"/"+nginxID)
+	if !found || pod != (PodContainer{Namespace: "shop", Pod: "web-7d9c", Container: "nginx"}) {
+		t.Errorf("unexpected container resolved: %+v %v", pod, found)
+	}
+	pod, found = resolveCgroup(context.Background(), "/kubepods/burstable/pod"+dnsPodUID)
+	if !found || pod != (PodContainer{Namespace: "kube-system", Pod: "coredns-5d78"}) {
+		t.Errorf("unexpected pod resolved: %+v %v", pod, found)
+	}
+
+	// misses refresh the cache at most every minRefreshInterval
+	if _, found := resolveCgroup(context.Background(), "/kubepods/burstable/pod"+webPodUID+"/"+unknownID); found {
+		t.Errorf("expected unknown container not to be resolved")
+	}
+	if count := requests.Load(); count != 1 {
+		t.Errorf("expected pods to be fetched once, got %d", count)
+	}
+
+}
+
+func TestReportKubernetesPods(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+	podSlice := "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + strings.ReplaceAll(webPodUID, "-", "_") + ".slice"
+	cgroupRoot := helper.SetupSysfsTree(t, map[string]string{
+		"cgroup.controllers":   "cpu memory pids\n",
+		podSlice + "/cpu.stat": "usage_usec 9000000\n",
+		podSlice + "/cri-containerd-" + nginxID + ".scope/cpu.stat":       "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+		podSlice + "/cri-containerd-" + nginxID + ".scope/memory.current": "52428800\n",
+		podSlice + "/cri-containerd-" + nginxID + ".scope/pids.current":   "3\n",
+		podSlice + "/cri-containerd-" + unknownID + ".scope/cpu.stat":     "usage_usec 1\n",
+		"system.slice/sshd.service/cpu.stat":                              "usage_usec 1\n",
+	})
+	t.Setenv("SYS_FS_CGROUP", cgroupRoot)
+
+	mc := collector.CreateMetricCollector()
+	setupResolver(t, mc)
+
+	ReportKubernetesPods(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_kubelet_up", 1)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_cpu_seconds_total|shop|web-7d9c|nginx", 2.5)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_memory_usage_bytes|shop|web-7d9c|nginx", 52428800)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_processes|shop|web-7d9c|nginx", 3)
+	helper.VerifyGatheredMetric(t, mc, "metricly_kubernetes_container_cpu_seconds_total", map[string]string{
+		"namespace": "shop",
+		"pod":       "web-7d9c",
+		"container": "nginx",
+		"hostname":  "testhost",
+	}, 2.5)
+
+	for key := range mc.Data {
+		if strings.HasPrefix(key, "metricly_kubernetes_container_") && !strings.Contains(key, "|nginx") {
+			t.Errorf("unexpected series %s", key)
+		}
+	}
+
+	// a kubelet rejecting the token marks it down without dropping the cache
+	os.WriteFile(filepath.Join(filepath.Dir(tokenFile), "token"), []byte("revoked"), 0600)
+	resolver.refreshed = resolver.refreshed.Add(-cacheTTL)
+	ReportKubernetesPods(context.Background(), mc)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_kubelet_up", 0)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_cpu_seconds_total|shop|web-7d9c|nginx", 2.5)
+}
+
+func TestReportKubernetesPodsCgroupV1(t *testing.T) {
+	podDir := "kubepods/burstable/pod" + webPodUID + "/" + nginxID
+	cgroupRoot := helper.SetupSysfsTree(t, map[string]string{
+		"cpu,cpuacct/" + podDir + "/cpuacct.usage":    "2500000000\n",
+		"memory/" + podDir + "/memory.usage_in_bytes": "52428800\n",
+		"memory/system.slice/memory.usage_in_bytes":   "1\n",
+		"pids/" + podDir + "/pids.current":            "3\n",
+	})
+	if err := os.Symlink("cpu,cpuacct", filepath.Join(cgroupRoot, "cpuacct")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SYS_FS_CGROUP", cgroupRoot)
+
+	mc := collector.CreateMetricCollector()
+	setupResolver(t, mc)
+
+	ReportKubernetesPods(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_cpu_seconds_total|shop|web-7d9c|nginx", 2.5)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_memory_usage_bytes|shop|web-7d9c|nginx", 52428800)
+	helper.VerifyMetric(t, mc, "metricly_kubernetes_container_processes|shop|web-7d9c|nginx", 3)
+}
+
+func TestRegisterKubernetesMetricsDisabled(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+
+	if RegisterKubernetesMetrics(mc, config.KubernetesConfig{Enabled: false}) {
+		t.Errorf("expected kubernetes collector to be disabled by default")
+	}
+	if RegisterKubernetesMetrics(mc, config.KubernetesConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.crt")}) {
+		t.Errorf("expected missing CA to disable kubernetes collector")
+	}
+	if _, exists := mc.Metrics["metricly_kubernetes_kubelet_up"]; exists {
+		t.Errorf("expected no metric to be registered when disabled")
+	}
+}
@@ -0,0 +1,254 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+
+	// a container missing from the cache triggers a refresh, at most this
+	// often so unknown cgroups don't hammer the kubelet
+	minRefreshInterval = 10 * time.Second
+)
+
+var (
+	kubeletURL = "https://127.0.0.1:10250"
+	tokenFile  = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	caFile     = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	cacheTTL   = time.Minute
+
+	// set by RegisterKubernetesMetrics, nil while disabled
+	resolver *podResolver
+
+	// pod UID as it appears in cgroup paths, dashes become underscores with
+	// the systemd cgroup driver
+	podUIDRegex = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+	// container scope of containerd, CRI-O or docker, conmon scopes of CRI-O
+	// don't match
+	containerIDRegex = regexp.MustCompile(`^(?:cri-containerd-|crio-|docker-)?([0-9a-f]{64})(?:\.scope)?$`)
+)
+
+// PodContainer identifies a container of a pod
+type PodContainer struct {
+	Namespace string
+	Pod       string
+	// empty for cgroups of the pod itself
+	Container string
+}
+
+// podList holds the fields of the kubelet /pods response used here
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"metadata"`
+		Status struct {
+			InitContainerStatuses      []containerStatus `json:"initContainerStatuses"`
+			ContainerStatuses          []containerStatus `json:"containerStatuses"`
+			EphemeralContainerStatuses []containerStatus `json:"ephemeralContainerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type containerStatus struct {
+	Name string `json:"name"`
+	// <runtime>://<id>
+	ContainerID string `json:"containerID"`
+}
+
+// podResolver caches the pods running on the node, keyed by container ID and
+// pod UID
+type podResolver struct {
+	mutex       sync.Mutex
+	client      *http.Client
+	byContainer map[string]PodContainer
+	byPod       map[string]PodContainer
+	refreshed   time.Time
+	attempted   time.Time
+}
+
+// newResolver builds the kubelet client from the collector settings
+func newResolver(kubernetes config.KubernetesConfig) (*podResolver, error) {
+	if kubernetes.KubeletURL != "" {
+		kubeletURL = strings.TrimSuffix(kubernetes.KubeletURL, "/")
+	}
+	if kubernetes.TokenFile != "" {
+		tokenFile = kubernetes.TokenFile
+	}
+	if kubernetes.CAFile != "" {
+		caFile = kubernetes.CAFile
+	}
+	if kubernetes.CacheTTL > 0 {
+		cacheTTL = kubernetes.CacheTTL
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: kubernetes.InsecureSkipVerify}
+	if !kubernetes.InsecureSkipVerify {
+		ca, err := os.ReadFile(caFile)
+		switch {
+		case err == nil:
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificate found in %s", caFile)
+			}
+		case os.IsNotExist(err) && kubernetes.CAFile == "":
+			// no service account mounted, fall back to system roots
+		default:
+			return nil, fmt.Errorf("failed to read CA: %v", err)
+		}
+	}
+
+	return &podResolver{
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// fetchPods lists the pods of the node from the kubelet
+func (r *podResolver) fetchPods(ctx context.Context) (*podList, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, kubeletURL+"/pods", nil)
+	if err != nil {
+		return nil, err
+	}
+	// read on every request, projected tokens are rotated
+	token, err := os.ReadFile(tokenFile)
+	if err == nil {
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read token: %v", err)
+	}
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s/pods returned %s", kubeletURL, response.Status)
+	}
+	var pods podList
+	if err := json.NewDecoder(response.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("failed to decode pods: %v", err)
+	}
+	return &pods, nil
+}
+
+// refresh replaces the cache with the pods listed by the kubelet. The
+// previous cache is kept on failure. Callers must hold the mutex.
+func (r *podResolver) refresh(ctx context.Context) error {
+	r.attempted = time.Now()
+	pods, err := r.fetchPods(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list pods from kubelet: %v", err)
+	}
+
+	byContainer := make(map[string]PodContainer)
+	byPod := make(map[string]PodContainer)
+	for _, pod := range pods.Items {
+		byPod[pod.Metadata.UID] = PodContainer{Namespace: pod.Metadata.Namespace, Pod: pod.Metadata.Name}
+
+		statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+		for _, status := range append(statuses, pod.Status.EphemeralContainerStatuses...) {
+			_, id, found := strings.Cut(status.ContainerID, "://")
+			if !found || id == "" {
+				// not started yet
+				continue
+			}
+			byContainer[id] = PodContainer{
+				Namespace: pod.Metadata.Namespace,
+				Pod:       pod.Metadata.Name,
+				Container: status.Name,
+			}
+		}
+	}
+	r.byContainer = byContainer
+	r.byPod = byPod
+	r.refreshed = r.attempted
+	return nil
+}
+
+// ensureFresh refreshes the cache once its TTL expired
+func (r *podResolver) ensureFresh(ctx context.Context) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.refreshed) < cacheTTL {
+		return nil
+	}
+	return r.refresh(ctx)
+}
+
+// lookup resolves a container ID, or a pod UID if the container ID is empty,
+// refreshing the cache on misses since the pod may be newer than the cache
+func (r *podResolver) lookup(ctx context.Context, podUID, containerID string) (PodContainer, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if containerID != "" {
+			if pod, exists := r.byContainer[containerID]; exists {
+				return pod, true
+			}
+		} else if pod, exists := r.byPod[podUID]; exists {
+			return pod, true
+		}
+
+		if attempt > 0 || time.Since(r.attempted) < minRefreshInterval {
+			return PodContainer{}, false
+		}
+		if err := r.refresh(ctx); err != nil {
+			slog.Warn(fmt.Sprint(err))
+			return PodContainer{}, false
+		}
+	}
+}
+
+// parseCgroupPath extracts the pod UID and container ID out of a cgroup
+// path of the systemd or cgroupfs driver, e.g.
+// /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+// /kubepods/burstable/pod<uid>/<id>
+func parseCgroupPath(path string) (podUID, containerID string) {
+	match := podUIDRegex.FindStringSubmatch(path)
+	if match == nil {
+		return "", ""
+	}
+	podUID = strings.ReplaceAll(match[1], "_", "-")
+
+	if match := containerIDRegex.FindStringSubmatch(filepath.Base(path)); match != nil {
+		containerID = match[1]
+	}
+	return podUID, containerID
+}
+
+// resolveCgroup returns the pod and container owning a cgroup path. It
+// returns false if the path doesn't belong to a known pod or the kubernetes
+// collector is disabled.
+func resolveCgroup(ctx context.Context, path string) (PodContainer, bool) {
+	if resolver == nil {
+		return PodContainer{}, false
+	}
+	podUID, containerID := parseCgroupPath(path)
+	if podUID == "" {
+		return PodContainer{}, false
+	}
+	return resolver.lookup(ctx, podUID, containerID)
+}
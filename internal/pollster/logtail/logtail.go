@@ -0,0 +1,347 @@
+package logtail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	typeCounter   = "counter"
+	typeHistogram = "histogram"
+	valueGroup    = "value"
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	stateFile string
+	tailers   []*tailer
+	// lines read per file since startup
+	linesRead map[string]float64
+	linesDesc *prometheus.Desc
+)
+
+// series holds the value of a counter or the observations of a histogram
+// for one set of label values
+type series struct {
+	LabelValues []string
+	Value       float64
+	Count       uint64
+	Sum         float64
+	Buckets     map[float64]uint64
+}
+
+// rule is a compiled LogRuleConfig with the series it accumulated
+type rule struct {
+	Name      string
+	Regex     *regexp.Regexp
+	Histogram bool
+	Buckets   []float64
+	Desc      *prometheus.Desc
+	series    map[string]*series
+}
+
+// compileRule validates a rule and prepares its regex and descriptor
+func compileRule(logRule config.LogRuleConfig) (*rule, error) {
+	if !validName.MatchString(logRule.Name) {
+		return nil, fmt.Errorf("invalid metric name %q", logRule.Name)
+	}
+	regex, err := regexp.Compile(logRule.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+
+	r := &rule{Name: logRule.Name, Regex: regex, series: make(map[string]*series)}
+	switch logRule.Type {
+	case "", typeCounter:
+	case typeHistogram:
+		r.Histogram = true
+		r.Buckets = logRule.Buckets
+		if len(r.Buckets) == 0 {
+			r.Buckets = prometheus.DefBuckets
+		}
+		if !sort.Float64sAreSorted(r.Buckets) {
+			return nil, fmt.Errorf("buckets must be in increasing order")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %q", logRule.Type)
+	}
+
+	var (
+		labels   []string
+		hasValue bool
+	)
+	for _, group := range regex.SubexpNames() {
+		switch {
+		case group == "":
+			continue
+		case group == valueGroup:
+			hasValue = true
+		case group == "hostname":
+			return nil, fmt.Errorf("capture group %q clashes with a reserved label", group)
+		case !validName.MatchString(group):
+			return nil, fmt.Errorf("capture group %q is not a valid label name", group)
+		default:
+			labels = append(labels, group)
+		}
+	}
+	if r.Histogram && !hasValue {
+		return nil, fmt.Errorf("histograms need a %q capture group", valueGroup)
+	}
+
+	help := logRule.Help
+	if help == "" {
+		help = fmt.Sprintf("Log lines matching %s", logRule.Regex)
+	}
+	r.Desc = prometheus.NewDesc(metricName(logRule), help, labels, prometheus.Labels{"hostname": common.GetHostname()})
+	return r, nil
+}
+
+// carryOver keeps the series accumulated by a rule of the previous
+// configuration matching lines the same way
+func (r *rule) carryOver(previous []*rule) {
+	for _, old := range previous {
+		if old.Name == r.Name && old.Regex.String() == r.Regex.String() &&
+			old.Histogram == r.Histogram && slices.Equal(old.Buckets, r.Buckets) {
+			r.series = old.series
+			return
+		}
+	}
+}
+
+// metricName prefixes the rule name and adds the _total suffix to counters
+func metricName(logRule config.LogRuleConfig) string {
+	name := "metricly_" + logRule.Name
+	if logRule.Type != typeHistogram && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	return name
+}
+
+// match updates the series of a rule if line matches its regex
+func (r *rule) match(line string) {
+	match := r.Regex.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+
+	value := 1.0
+	var labelValues []string
+	for i, group := range r.Regex.SubexpNames() {
+		switch group {
+		case "":
+		case valueGroup:
+			parsed, err := strconv.ParseFloat(match[i], 64)
+			if err != nil {
+				slog.Debug(fmt.Sprintf("logtail %s: ignoring invalid value %q", r.Name, match[i]))
+				return
+			}
+			value = parsed
+		default:
+			labelValues = append(labelValues, match[i])
+		}
+	}
+
+	signature := strings.Join(labelValues, "\xff")
+	s, exists := r.series[signature]
+	if !exists {
+		s = &series{LabelValues: labelValues, Buckets: make(map[float64]uint64)}
+		r.series[signature] = s
+	}
+
+	if !r.Histogram {
+		// counters can't go down
+		if value > 0 {
+			s.Value += value
+		}
+		return
+	}
+	s.Count++
+	s.Sum += value
+	for _, bucket := range r.Buckets {
+		if value <= bucket {
+			s.Buckets[bucket]++
+		}
+	}
+}
+
+// metrics builds the const metrics of every series of the rule
+func (r *rule) metrics() []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, s := range r.series {
+		var (
+			metric prometheus.Metric
+			err    error
+		)
+		if r.Histogram {
+			buckets := make(map[float64]uint64, len(r.Buckets))
+			for _, bucket := range r.Buckets {
+				buckets[bucket] = s.Buckets[bucket]
+			}
+			metric, err = prometheus.NewConstHistogram(r.Desc, s.Count, s.Sum, buckets, s.LabelValues...)
+		} else {
+			metric, err = prometheus.NewConstMetric(r.Desc, prometheus.CounterValue, s.Value, s.LabelValues...)
+		}
+		if err != nil {
+			slog.Warn(fmt.Sprintf("logtail %s: %v", r.Name, err))
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// RegisterLogtailMetrics registers logtail metrics, compiles the configured
+// rules and restores file positions from the state file. Files of the
+// previous configuration keep their position and counters.
+func RegisterLogtailMetrics(mc *collector.MetriclyCollector, logtail config.LogtailConfig) {
+	mc.AddMetric("logtail_file_error", "1 if the log file could not be read, 0 otherwise", []string{"file"})
+	linesDesc = prometheus.NewDesc(
+		"metricly_logtail_lines_total",
+		"Number of lines read from the log file",
+		[]string{"file"},
+		prometheus.Labels{"hostname": common.GetHostname()},
+	)
+
+	// files still configured after a reload keep their tailer and counters,
+	// so lines are neither read twice nor counted from zero
+	previous := make(map[string]*tailer)
+	for _, t := range tailers {
+		previous[t.Path] = t
+	}
+	previousLinesRead := linesRead
+	tailers = nil
+	linesRead = make(map[string]float64)
+	stateFile = logtail.StateFile
+
+	states := make(map[string]fileState)
+	if stateFile != "" {
+		var err error
+		if states, err = loadState(stateFile); err != nil {
+			slog.Warn(fmt.Sprintf("failed to load logtail state, reading files from their end: %v", err))
+		}
+	}
+
+	names := make(map[string]bool)
+	paths := make(map[string]bool)
+	for _, file := range logtail.Files {
+		if paths[file.Path] {
+			slog.Error(fmt.Sprintf("skipping log file %s: listed more than once", file.Path))
+			continue
+		}
+
+		var rules []*rule
+		for _, logRule := range file.Rules {
+			r, err := compileRule(logRule)
+			if err != nil {
+				slog.Error(fmt.Sprintf("skipping logtail rule %q of %s: %v", logRule.Name, file.Path, err))
+				continue
+			}
+			name := metricName(logRule)
+			mc.Mutex.Lock()
+			_, builtin := mc.Metrics[name]
+			mc.Mutex.Unlock()
+			if names[name] || builtin {
+				slog.Error(fmt.Sprintf("skipping logtail rule %q of %s: metric %s is already defined", logRule.Name, file.Path, name))
+				continue
+			}
+			names[name] = true
+			rules = append(rules, r)
+		}
+		if file.Path == "" || len(rules) == 0 {
+			slog.Error(fmt.Sprintf("skipping log file %q: path and at least one valid rule are required", file.Path))
+			continue
+		}
+
+		paths[file.Path] = true
+		if t, exists := previous[file.Path]; exists {
+			delete(previous, file.Path)
+			for _, r := range rules {
+				r.carryOver(t.Rules)
+			}
+			t.Rules = rules
+			linesRead[file.Path] = previousLinesRead[file.Path]
+			tailers = append(tailers, t)
+			continue
+		}
+		state, hasState := states[file.Path]
+		t := newTailer(file.Path, state, hasState)
+		t.Rules = rules
+		tailers = append(tailers, t)
+	}
+
+	for _, t := range previous {
+		t.close()
+	}
+}
+
+// Close saves the position of every file and closes them, once collections
+// stopped
+func Close() {
+	if stateFile != "" && len(tailers) > 0 {
+		states := make(map[string]fileState)
+		for _, t := range tailers {
+			states[t.Path] = t.state()
+		}
+		if err := saveState(stateFile, states); err != nil {
+			slog.Warn(fmt.Sprintf("failed to save logtail state: %v", err))
+		}
+	}
+	for _, t := range tailers {
+		t.close()
+	}
+	tailers = nil
+}
+
+// ReportLogtail reads new lines of every log file and saves their positions.
+func ReportLogtail(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	states := make(map[string]fileState)
+	var metrics []prometheus.Metric
+	for _, t := range tailers {
+		fileError := 0.0
+		lines, err := t.poll(func(line string) {
+			for _, r := range t.Rules {
+				r.match(line)
+			}
+		})
+		if err != nil {
+			slog.Warn(fmt.Sprintf("logtail %s: %v", t.Path, err))
+			fileError = 1
+		}
+		linesRead[t.Path] += float64(lines)
+		mc.UpdateMetric("logtail_file_error", fileError, []string{t.Path})
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(linesDesc, prometheus.CounterValue, linesRead[t.Path], t.Path))
+		for _, r := range t.Rules {
+			metrics = append(metrics, r.metrics()...)
+		}
+		states[t.Path] = t.state()
+	}
+	setErr := mc.SetMetrics("logtail", metrics)
+	if setErr != nil {
+		setErr = fmt.Errorf("skipping logtail metrics: %v", setErr)
+	}
+
+	if stateFile != "" {
+		if err := saveState(stateFile, states); err != nil {
+			slog.Warn(fmt.Sprintf("failed to save logtail state: %v", err))
+		}
+	}
+
+	slog.Info(fmt.Sprintf("Collected Logtail metrics in %s", time.Since(start)))
+	return setErr
+}
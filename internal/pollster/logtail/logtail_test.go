@@ -0,0 +1,147 @@
+package logtail
+
+import (
+	"context"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var accessLogConfig = []config.LogRuleConfig{
+	{
+		Name:  "nginx_server_errors",
+		Regex: `^(?P<vhost>\S+) .* (?P<status>5[0-9]{2}) `,
+	},
+	{
+		Name:    "nginx_request_duration_seconds",
+		Regex:   ` rt=(?P<value>[0-9.]+)$`,
+		Type:    "histogram",
+		Buckets: []float64{0.1, 1},
+	},
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Join(lines, "")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompileRule(t *testing.T) {
+	invalid := []config.LogRuleConfig{
+		{Name: "bad-name", Regex: `error`},
+		{Name: "bad_regex", Regex: `(error`},
+		{Name: "bad_type", Regex: `error`, Type: "gauge"},
+		{Name: "no_value", Regex: `error`, Type: "histogram"},
+		{Name: "unsorted", Regex: `(?P<value>\d+)`, Type: "histogram", Buckets: []float64{1, 0.5}},
+	}
+	for _, logRule := range invalid {
+		if _, err := compileRule(logRule); err == nil {
+			t.Errorf("expected rule %s to be rejected", logRule.Name)
+		}
+	}
+}
+
+func TestReportLogtail(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	statePath := filepath.Join(dir, "logtail.json")
+	logtail := config.LogtailConfig{
+		StateFile: statePath,
+		Files:     []config.LogFileConfig{{Path: logPath, Rules: accessLogConfig}},
+	}
+
+	// lines present before the first start are not counted
+	appendLines(t, logPath, "shop.example.com GET / 500 rt=0.5\n")
+
+	mc := collector.CreateMetricCollector()
+	RegisterLogtailMetrics(mc, logtail)
+	ReportLogtail(context.Background(), mc)
+
+	appendLines(t, logPath,
+		"shop.example.com GET / 502 rt=0.05\n",
+		"shop.example.com GET / 200 rt=0.2\n",
+		"api.example.com GET /v1 503 rt=2\n",
+		// partial lines are counted once complete
+		"api.example.com GET /v1 500 ",
+	)
+	ReportLogtail(context.Background(), mc)
+
+	errors := map[string]string{"vhost": "shop.example.com", "status": "502", "hostname": "testhost"}
+	helper.VerifyGatheredMetric(t, mc, "metricly_nginx_server_errors_total", errors, 1)
+	helper.VerifyGatheredMetric(t, mc, "metricly_logtail_lines_total", map[string]string{"file": logPath}, 3)
+	helper.VerifyMetric(t, mc, "metricly_logtail_file_error|"+logPath, 0)
+
+	families := helper.GatherMetrics(t, mc)
+	if helper.FindGatheredMetric(families, "metricly_nginx_server_errors_total", map[string]string{"status": "500"}) != nil {
+		t.Errorf("expected lines written before the first start to be skipped")
+	}
+	histogram := helper.FindGatheredMetric(families, "metricly_nginx_request_duration_seconds", map[string]string{})
+	if histogram == nil || histogram.Histogram.GetSampleCount() != 3 || histogram.Histogram.Bucket[0].GetCumulativeCount() != 1 {
+		t.Fatalf("expected 3 observations with 1 in the first bucket, got %v", histogram)
+	}
+
+	// rotation: lines written to the old file before reopening are not lost
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, logPath+".1", "rt=0.01\n")
+	appendLines(t, logPath, "shop.example.com GET / 502 rt=0.3\n")
+	ReportLogtail(context.Background(), mc)
+
+	helper.VerifyGatheredMetric(t, mc, "metricly_nginx_server_errors_total", errors, 2)
+	helper.VerifyGatheredMetric(t, mc, "metricly_nginx_server_errors_total", map[string]string{"vhost": "api.example.com", "status": "500"}, 1)
+
+	// truncation restarts from the beginning of the file
+	if err := os.WriteFile(logPath, []byte("a GET / 502 \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ReportLogtail(context.Background(), mc)
+	helper.VerifyGatheredMetric(t, mc, "metricly_nginx_server_errors_total", map[string]string{"vhost": "a"}, 1)
+
+	// a reload keeps counters of unchanged rules and resets changed ones
+	reloaded := config.LogtailConfig{
+		StateFile: statePath,
+		Files: []config.LogFileConfig{{Path: logPath, Rules: []config.LogRuleConfig{
+			accessLogConfig[0],
+			{Name: "nginx_request_duration_seconds", Regex: ` rt=(?P<value>[0-9.]+)$`, Type: "histogram", Buckets: []float64{0.5}},
+		}}},
+	}
+	RegisterLogtailMetrics(mc, reloaded)
+	appendLines(t, logPath, "shop.example.com GET / 502 rt=0.3\n")
+	ReportLogtail(context.Background(), mc)
+	helper.VerifyGatheredMetric(t, mc, "metricly_nginx_server_errors_total", errors, 3)
+	histogram = helper.FindGatheredMetric(helper.GatherMetrics(t, mc), "metricly_nginx_request_duration_seconds", map[string]string{})
+	if histogram == nil || histogram.Histogram.GetSampleCount() != 1 {
+		t.Errorf("expected histogram with new buckets to start over, got %v", histogram)
+	}
+
+	// a restart resumes from the saved offset so lines aren't counted twice
+	for _, tailer := range tailers {
+		tailer.close()
+	}
+	tailers = nil
+	mc = collector.CreateMetricCollector()
+	RegisterLogtailMetrics(mc, logtail)
+	appendLines(t, logPath, "shop.example.com GET / 502 rt=0.3\n")
+	ReportLogtail(context.Background(), mc)
+	helper.VerifyGatheredMetric(t, mc, "metricly_nginx_server_errors_total", errors, 1)
+
+	// a missing file is reported as an error
+	if err := os.Remove(logPath); err != nil {
+		t.Fatal(err)
+	}
+	RegisterLogtailMetrics(mc, logtail)
+	ReportLogtail(context.Background(), mc)
+	helper.VerifyMetric(t, mc, "metricly_logtail_file_error|"+logPath, 1)
+}
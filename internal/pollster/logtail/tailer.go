@@ -0,0 +1,216 @@
+package logtail
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	// a line longer than this is handled in pieces so a file without
+	// newlines can't grow the read buffer forever
+	maxLineBytes = 1 << 20
+)
+
+// fileState is the position of a tailer persisted across restarts
+type fileState struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// tailer follows a log file across rotation and truncation. The file is
+// kept open so lines written to a rotated file before it is reopened are
+// not lost.
+type tailer struct {
+	Path   string
+	Rules  []*rule
+	file   *os.File
+	inode  uint64
+	offset int64
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
+
+// newTailer restores the position of a file from its saved state. Without
+// state, reading starts at the end of an existing file so old lines are not
+// counted at first start, and at the beginning of a file created later.
+func newTailer(path string, state fileState, hasState bool) *tailer {
+	t := &tailer{Path: path}
+	if hasState {
+		t.inode = state.Inode
+		t.offset = state.Offset
+		return t
+	}
+	if info, err := os.Stat(path); err == nil {
+		t.inode = inodeOf(info)
+		t.offset = info.Size()
+	}
+	return t
+}
+
+// state returns the position to persist
+func (t *tailer) state() fileState {
+	return fileState{Inode: t.inode, Offset: t.offset}
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// poll passes every complete line written since the last poll to handle
+func (t *tailer) poll(handle func(string)) (int, error) {
+	lines := 0
+
+	// drain the file currently open first, it may have been rotated
+	if t.file != nil {
+		n, err := t.readLines(handle)
+		lines += n
+		if err != nil {
+			t.close()
+			return lines, err
+		}
+	}
+
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		// keep following the rotated file until the new one shows up
+		return lines, err
+	}
+
+	if t.file != nil && inodeOf(info) == t.inode {
+		if info.Size() >= t.offset {
+			return lines, nil
+		}
+		// truncated in place, e.g. by logrotate's copytruncate
+		t.offset = 0
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			t.close()
+			return lines, err
+		}
+	} else {
+		t.close()
+		if err := t.open(); err != nil {
+			return lines, err
+		}
+	}
+
+	n, err := t.readLines(handle)
+	lines += n
+	if err != nil {
+		t.close()
+	}
+	return lines, err
+}
+
+// open opens the file at path and resumes at the saved offset if it is
+// still the same file
+func (t *tailer) open() error {
+	file, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	inode := inodeOf(info)
+	if inode != t.inode || info.Size() < t.offset {
+		t.offset = 0
+	}
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	t.file = file
+	t.inode = inode
+	return nil
+}
+
+// readLines reads up to the last complete line, a partial line is read
+// again on the next poll once it is complete
+func (t *tailer) readLines(handle func(string)) (int, error) {
+	reader := bufio.NewReader(t.file)
+	lines := 0
+	for {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// the line is consumed anyway once it exceeds maxLineBytes
+			var rest []byte
+			for errors.Is(err, bufio.ErrBufferFull) && len(line)+len(rest) < maxLineBytes {
+				rest = append(rest, line...)
+				line, err = reader.ReadSlice('\n')
+			}
+			line = append(rest, line...)
+			if errors.Is(err, bufio.ErrBufferFull) {
+				err = nil
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+		t.offset += int64(len(line))
+		handle(strings.TrimRight(string(line), "\r\n"))
+		lines++
+	}
+
+	_, err := t.file.Seek(t.offset, io.SeekStart)
+	return lines, err
+}
+
+// loadState reads saved positions keyed by file path
+func loadState(path string) (map[string]fileState, error) {
+	states := make(map[string]fileState)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return states, err
+	}
+	if err := json.Unmarshal(content, &states); err != nil {
+		return make(map[string]fileState), fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return states, nil
+}
+
+// saveState atomically replaces the state file
+func saveState(path string, states map[string]fileState) error {
+	content, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	sysKernelHugepages = "/sys/kernel/mm/hugepages"
+)
+
+// hugepageStats holds counters of a single hugepage size
+type hugepageStats struct {
+	Size     string // e.g. 2048kB, taken from the hugepages-2048kB directory
+	Total    uint64
+	Free     uint64
+	Reserved uint64
+	Surplus  uint64
+}
+
+// readHugepageStats reads every hugepages-<size> directory under hugepagesDir.
+// NUMA node directories don't expose resv_hugepages, it is reported as 0 there.
+func readHugepageStats(hugepagesDir string) ([]hugepageStats, error) {
+
+	sizeDirs, err := filepath.Glob(filepath.Join(hugepagesDir, "hugepages-*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hugepage sizes in %s: %v", hugepagesDir, err)
+	}
+
+	var stats []hugepageStats
+	for _, sizeDir := range sizeDirs {
+		stat := hugepageStats{
+			Size: strings.TrimPrefix(filepath.Base(sizeDir), "hugepages-"),
+		}
+
+		total, err := common.ReadSysfsValue(filepath.Join(sizeDir, "nr_hugepages"))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("failed to read hugepages of size %s: %v", stat.Size, err))
+			continue
+		}
+		stat.Total = common.ParseUint(total)
+
+		if free, err := common.ReadSysfsValue(filepath.Join(sizeDir, "free_hugepages")); err == nil {
+			stat.Free = common.ParseUint(free)
+		}
+		if reserved, err := common.ReadSysfsValue(filepath.Join(sizeDir, "resv_hugepages")); err == nil {
+			stat.Reserved = common.ParseUint(reserved)
+		}
+		if surplus, err := common.ReadSysfsValue(filepath.Join(sizeDir, "surplus_hugepages")); err == nil {
+			stat.Surplus = common.ParseUint(surplus)
+		}
+
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func RegisterHugepagesMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("memory_hugepages_size_total", "Total number of hugepages of the page size", []string{"size"})
+	mc.AddMetric("memory_hugepages_size_free", "Free hugepages of the page size", []string{"size"})
+	mc.AddMetric("memory_hugepages_size_rsvd", "Reserved hugepages of the page size", []string{"size"})
+	mc.AddMetric("memory_hugepages_size_surp", "Surplus hugepages of the page size", []string{"size"})
+	mc.AddMetric("memory_numa_hugepages_total", "Total number of hugepages of the page size on the NUMA node", []string{"node", "size"})
+	mc.AddMetric("memory_numa_hugepages_free", "Free hugepages of the page size on the NUMA node", []string{"node", "size"})
+	mc.AddMetric("memory_numa_hugepages_surp", "Surplus hugepages of the page size on the NUMA node", []string{"node", "size"})
+}
+
+// ReportHugepagesUsage reports hugepage counters per page size, system wide and per NUMA node.
+func ReportHugepagesUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	if sysKernelHugepagesEnv := os.Getenv("SYS_KERNEL_HUGEPAGES"); sysKernelHugepagesEnv != "" {
+		sysKernelHugepages = sysKernelHugepagesEnv
+	}
+
+	stats, err := readHugepageStats(sysKernelHugepages)
+	if err != nil {
+		return err
+	}
+	for _, stat := range stats {
+		mc.UpdateMetric("memory_hugepages_size_total", float64(stat.Total), []string{stat.Size})
+		mc.UpdateMetric("memory_hugepages_size_free", float64(stat.Free), []string{stat.Size})
+		mc.UpdateMetric("memory_hugepages_size_rsvd", float64(stat.Reserved), []string{stat.Size})
+		mc.UpdateMetric("memory_hugepages_size_surp", float64(stat.Surplus), []string{stat.Size})
+	}
+
+	nodes, err := listNumaNodes()
+	if err != nil {
+		slog.Warn(fmt.Sprint(err))
+	}
+	for _, node := range nodes {
+		nodeStats, err := readHugepageStats(filepath.Join(sysDevicesNode, node, "hugepages"))
+		if err != nil {
+			slog.Warn(fmt.Sprint(err))
+			continue
+		}
+		nodeID := strings.TrimPrefix(node, "node")
+		for _, stat := range nodeStats {
+			mc.UpdateMetric("memory_numa_hugepages_total", float64(stat.Total), []string{nodeID, stat.Size})
+			mc.UpdateMetric("memory_numa_hugepages_free", float64(stat.Free), []string{nodeID, stat.Size})
+			mc.UpdateMetric("memory_numa_hugepages_surp", float64(stat.Surplus), []string{nodeID, stat.Size})
+		}
+	}
+
+	slog.Info(fmt.Sprintf("Collected Hugepages metrics in %s", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	pollster "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"testing"
+)
+
+func TestReadHugepageStats(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"hugepages-2048kB/nr_hugepages":         "1024\n",
+		"hugepages-2048kB/free_hugepages":       "512\n",
+		"hugepages-2048kB/resv_hugepages":       "16\n",
+		"hugepages-2048kB/surplus_hugepages":    "0\n",
+		"hugepages-1048576kB/nr_hugepages":      "8\n",
+		"hugepages-1048576kB/free_hugepages":    "2\n",
+		"hugepages-1048576kB/resv_hugepages":    "1\n",
+		"hugepages-1048576kB/surplus_hugepages": "4\n",
+	})
+
+	stats, err := readHugepageStats(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 hugepage sizes, got %d", len(stats))
+	}
+
+	// sorted lexically by directory name
+	if stats[0].Size != "1048576kB" || stats[0].Total != 8 || stats[0].Surplus != 4 {
+		t.Errorf("unexpected 1GB hugepage stats: %+v", stats[0])
+	}
+	if stats[1].Size != "2048kB" || stats[1].Free != 512 || stats[1].Reserved != 16 {
+		t.Errorf("unexpected 2MB hugepage stats: %+v", stats[1])
+	}
+}
+
+func TestReportHugepagesUsage(t *testing.T) {
+	hugepagesRoot := helper.SetupSysfsTree(t, map[string]string{
+		"hugepages-2048kB/nr_hugepages":      "1024\n",
+		"hugepages-2048kB/free_hugepages":    "512\n",
+		"hugepages-2048kB/resv_hugepages":    "16\n",
+		"hugepages-2048kB/surplus_hugepages": "0\n",
+	})
+	nodeRoot := helper.SetupSysfsTree(t, map[string]string{
+		"node0/hugepages/hugepages-2048kB/nr_hugepages":      "600\n",
+		"node0/hugepages/hugepages-2048kB/free_hugepages":    "300\n",
+		"node0/hugepages/hugepages-2048kB/surplus_hugepages": "0\n",
+		"node1/hugepages/hugepages-2048kB/nr_hugepages":      "424\n",
+		"node1/hugepages/hugepages-2048kB/free_hugepages":    "212\n",
+		"node1/hugepages/hugepages-2048kB/surplus_hugepages": "0\n",
+	})
+	tmpHugepages, tmpNode := sysKernelHugepages, sysDevicesNode
+	defer func() {
+		sysKernelHugepages = tmpHugepages
+		sysDevicesNode = tmpNode
+	}()
+	sysKernelHugepages = hugepagesRoot
+	sysDevicesNode = nodeRoot
+
+	mc := pollster.CreateMetricCollector()
+	RegisterHugepagesMetrics(mc)
+
+	ReportHugepagesUsage(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_memory_hugepages_size_total|2048kB", 1024)
+	helper.VerifyMetric(t, mc, "metricly_memory_hugepages_size_rsvd|2048kB", 16)
+	helper.VerifyMetric(t, mc, "metricly_memory_numa_hugepages_total|0|2048kB", 600)
+	helper.VerifyMetric(t, mc, "metricly_memory_numa_hugepages_free|1|2048kB", 212)
+}
@@ -2,6 +2,7 @@ package memory
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	collector "metricly/internal/collector"
@@ -91,12 +92,11 @@ func RegisterMemoryMetrics(mc *collector.MetriclyCollector) {
 	mc.AddMetric("memory_hugepages_surp", "Surplus hugepages", []string{})
 }
 
-func ReportMemoryUsage(mc *collector.MetriclyCollector) {
+func ReportMemoryUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
 	start := time.Now()
 	memStats, err := readMemoryStats()
 	if err != nil {
-		slog.Warn(fmt.Sprint(err))
-		return
+		return err
 	}
 
 	mc.UpdateMetric(
@@ -141,4 +141,5 @@ func ReportMemoryUsage(mc *collector.MetriclyCollector) {
 		[]string{},
 	)
 	slog.Info(fmt.Sprintf("Collected Memory metrics in %s", time.Since(start)))
+	return nil
 }
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"context"
 	pollster "metricly/internal/collector"
 	helper "metricly/internal/pollster/tests"
 	"os"
@@ -75,7 +76,7 @@ HugePages_Surp:         8`
 	mc := pollster.CreateMetricCollector()
 	RegisterMemoryMetrics(mc)
 
-	ReportMemoryUsage(mc)
+	ReportMemoryUsage(context.Background(), mc)
 
 	helper.VerifyMetric(t, mc, "metricly_memory_total_bytes", 16384000*1024)
 	helper.VerifyMetric(t, mc, "metricly_memory_free_bytes", 8192000*1024)
@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	sysDevicesNode = "/sys/devices/system/node"
+	nodeDirPattern = regexp.MustCompile(`^node[0-9]+$`)
+
+	// maps fields of nodeN/meminfo to the reported metric
+	numaMeminfoMetrics = map[string]string{
+		"MemTotal":  "memory_numa_total_bytes",
+		"MemFree":   "memory_numa_free_bytes",
+		"MemUsed":   "memory_numa_used_bytes",
+		"FilePages": "memory_numa_file_pages_bytes",
+		"AnonPages": "memory_numa_anon_pages_bytes",
+		"Shmem":     "memory_numa_shmem_bytes",
+	}
+
+	// maps fields of nodeN/numastat to the reported metric
+	numastatMetrics = map[string]string{
+		"numa_hit":       "memory_numa_hit_total",
+		"numa_miss":      "memory_numa_miss_total",
+		"numa_foreign":   "memory_numa_foreign_total",
+		"interleave_hit": "memory_numa_interleave_hit_total",
+		"local_node":     "memory_numa_local_node_total",
+		"other_node":     "memory_numa_other_node_total",
+	}
+)
+
+type numaNodeStats struct {
+	Node     string
+	Meminfo  map[string]uint64 // in bytes
+	Numastat map[string]uint64 // in pages
+}
+
+// readNodeMeminfo parses nodeN/meminfo, lines look like "Node 0 MemTotal:  32657232 kB"
+func readNodeMeminfo(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	meminfo := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		key := strings.TrimSuffix(fields[2], ":")
+		value := common.ParseUint(fields[3])
+		if len(fields) > 4 && fields[4] == "kB" {
+			// convert value to bytes
+			value *= 1024
+		}
+		meminfo[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return meminfo, nil
+}
+
+// readNodeNumastat parses nodeN/numastat, lines look like "numa_hit 123456"
+func readNodeNumastat(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	numastat := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		numastat[fields[0]] = common.ParseUint(fields[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return numastat, nil
+}
+
+// listNumaNodes returns node0, node1... directories under /sys/devices/system/node
+func listNumaNodes() ([]string, error) {
+
+	if sysDevicesNodeEnv := os.Getenv("SYS_DEVICES_NODE"); sysDevicesNodeEnv != "" {
+		sysDevicesNode = sysDevicesNodeEnv
+	}
+
+	entries, err := os.ReadDir(sysDevicesNode)
+	if os.IsNotExist(err) {
+		// not every kernel is built with NUMA support
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", sysDevicesNode, err)
+	}
+
+	var nodes []string
+	for _, entry := range entries {
+		if nodeDirPattern.MatchString(entry.Name()) {
+			nodes = append(nodes, entry.Name())
+		}
+	}
+	return nodes, nil
+}
+
+// readNumaStats reads per NUMA node meminfo and numastat
+func readNumaStats() ([]numaNodeStats, error) {
+
+	nodes, err := listNumaNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []numaNodeStats
+	for _, node := range nodes {
+		nodePath := filepath.Join(sysDevicesNode, node)
+
+		meminfo, err := readNodeMeminfo(filepath.Join(nodePath, "meminfo"))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("failed to read meminfo of %s: %v", node, err))
+			continue
+		}
+		numastat, err := readNodeNumastat(filepath.Join(nodePath, "numastat"))
+		if err != nil {
+			slog.Warn(fmt.Sprintf("failed to read numastat of %s: %v", node, err))
+		}
+
+		stats = append(stats, numaNodeStats{
+			// report "0" rather than "node0"
+			Node:     strings.TrimPrefix(node, "node"),
+			Meminfo:  meminfo,
+			Numastat: numastat,
+		})
+	}
+	return stats, nil
+}
+
+func RegisterNumaMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("memory_numa_total_bytes", "Total memory of the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_free_bytes", "Free memory of the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_used_bytes", "Used memory of the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_file_pages_bytes", "Page cache memory of the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_anon_pages_bytes", "Anonymous memory of the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_shmem_bytes", "Shared memory of the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_hit_total", "Pages successfully allocated on the intended NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_miss_total", "Pages allocated on the NUMA node despite preferring another node", []string{"node"})
+	mc.AddMetric("memory_numa_foreign_total", "Pages intended for the NUMA node but allocated on another node", []string{"node"})
+	mc.AddMetric("memory_numa_interleave_hit_total", "Interleave policy pages successfully allocated on the NUMA node", []string{"node"})
+	mc.AddMetric("memory_numa_local_node_total", "Pages allocated on the NUMA node by a process running on it", []string{"node"})
+	mc.AddMetric("memory_numa_other_node_total", "Pages allocated on the NUMA node by a process running on another node", []string{"node"})
+}
+
+// ReportNumaUsage reports per NUMA node memory usage and allocation counters.
+func ReportNumaUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	stats, err := readNumaStats()
+	if err != nil {
+		return err
+	}
+
+	for _, node := range stats {
+		for field, metric := range numaMeminfoMetrics {
+			if value, exists := node.Meminfo[field]; exists {
+				mc.UpdateMetric(metric, float64(value), []string{node.Node})
+			}
+		}
+		for field, metric := range numastatMetrics {
+			if value, exists := node.Numastat[field]; exists {
+				mc.UpdateMetric(metric, float64(value), []string{node.Node})
+			}
+		}
+	}
+
+	slog.Info(fmt.Sprintf("Collected NUMA metrics in %s", time.Since(start)))
+	return nil
+}
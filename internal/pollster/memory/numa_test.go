@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	pollster "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"path/filepath"
+	"testing"
+)
+
+var numaNode0Meminfo = `Node 0 MemTotal:       32657232 kB
+Node 0 MemFree:        10240000 kB
+Node 0 MemUsed:        22417232 kB
+Node 0 FilePages:       8192000 kB
+Node 0 AnonPages:       4096000 kB
+Node 0 Shmem:            102400 kB
+Node 0 HugePages_Total:     0`
+
+var numaNode0Numastat = `numa_hit 184739271
+numa_miss 120
+numa_foreign 64
+interleave_hit 5321
+local_node 184731190
+other_node 8201`
+
+func TestReadNumaStats(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"node0/meminfo":  numaNode0Meminfo,
+		"node0/numastat": numaNode0Numastat,
+		"node1/meminfo":  "Node 1 MemTotal:       32768000 kB\nNode 1 MemFree:        30000000 kB",
+		"online":         "0-1\n",
+	})
+	tmpSrc := sysDevicesNode
+	defer func() { sysDevicesNode = tmpSrc }()
+	sysDevicesNode = root
+
+	stats, err := readNumaStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 NUMA nodes, got %d", len(stats))
+	}
+
+	if stats[0].Node != "0" {
+		t.Errorf("expected node=0, got %s", stats[0].Node)
+	}
+	if expected := uint64(32657232 * 1024); stats[0].Meminfo["MemTotal"] != expected {
+		t.Errorf("expected MemTotal=%d, got %d", expected, stats[0].Meminfo["MemTotal"])
+	}
+	if stats[0].Meminfo["HugePages_Total"] != 0 {
+		t.Errorf("expected HugePages_Total=0, got %d", stats[0].Meminfo["HugePages_Total"])
+	}
+	if stats[0].Numastat["numa_miss"] != 120 {
+		t.Errorf("expected numa_miss=120, got %d", stats[0].Numastat["numa_miss"])
+	}
+	if expected := uint64(30000000 * 1024); stats[1].Meminfo["MemFree"] != expected {
+		t.Errorf("expected MemFree=%d, got %d", expected, stats[1].Meminfo["MemFree"])
+	}
+}
+
+func TestReportNumaUsage(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"node0/meminfo":  numaNode0Meminfo,
+		"node0/numastat": numaNode0Numastat,
+	})
+	tmpSrc := sysDevicesNode
+	defer func() { sysDevicesNode = tmpSrc }()
+	sysDevicesNode = root
+
+	mc := pollster.CreateMetricCollector()
+	RegisterNumaMetrics(mc)
+
+	if err := ReportNumaUsage(context.Background(), mc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	helper.VerifyMetric(t, mc, "metricly_memory_numa_total_bytes|0", 32657232*1024)
+	helper.VerifyMetric(t, mc, "metricly_memory_numa_used_bytes|0", 22417232*1024)
+	helper.VerifyMetric(t, mc, "metricly_memory_numa_hit_total|0", 184739271)
+	helper.VerifyMetric(t, mc, "metricly_memory_numa_other_node_total|0", 8201)
+
+	// kernels without NUMA support have no node directory
+	sysDevicesNode = filepath.Join(root, "missing")
+	if err := ReportNumaUsage(context.Background(), mc); err != nil {
+		t.Errorf("expected missing nodes to succeed, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package network
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	collector "metricly/internal/collector"
@@ -105,17 +106,26 @@ func calculatePerSecondMetrics(prev, curr []networkStats) ([]networkStats, error
 
 }
 
-func ReportNetworkUsage(mc *collector.MetriclyCollector) {
+func ReportNetworkUsage(ctx context.Context, mc *collector.MetriclyCollector) error {
 
 	start := time.Now()
-	prevNWStat, _ := readNetworkStats()
-	time.Sleep(1 * time.Second)
-	currNWStat, _ := readNetworkStats()
+	prevNWStat, err := readNetworkStats()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(1 * time.Second):
+	}
+	currNWStat, err := readNetworkStats()
+	if err != nil {
+		return err
+	}
 
 	increaseNWStats, err := calculatePerSecondMetrics(prevNWStat, currNWStat)
 	if err != nil {
-		slog.Warn(fmt.Sprint(err))
-		return
+		return err
 	}
 
 	for _, stat := range increaseNWStats {
@@ -169,4 +179,5 @@ func ReportNetworkUsage(mc *collector.MetriclyCollector) {
 		)
 	}
 	slog.Info(fmt.Sprintf("Collected Network metrics in %s", time.Since(start)))
+	return nil
 }
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"log"
 	pollster "metricly/internal/collector"
 	helper "metricly/internal/pollster/tests"
@@ -74,7 +75,7 @@ wlp0s20f3: 6540158835 5786650    0    2    0     0          0         0 14211006
 		}
 		fi.Close()
 	}()
-	ReportNetworkUsage(mc)
+	ReportNetworkUsage(context.Background(), mc)
 
 	helper.VerifyMetric(t, mc, "metricly_network_rx_bytes|wlp0s20f3", 100)
 	helper.VerifyMetric(t, mc, "metricly_network_rx_errors|wlp0s20f3", 2)
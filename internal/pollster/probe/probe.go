@@ -0,0 +1,356 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	typeHTTP = "http"
+	typeTCP  = "tcp"
+	typeTLS  = "tls"
+
+	// only the beginning of the body is matched against body_regex
+	maxBodyBytes = 1 << 20
+)
+
+// probeResult holds the outcome of a single probe
+type probeResult struct {
+	Success    bool
+	Duration   time.Duration
+	Phases     map[string]time.Duration
+	StatusCode int
+	// NotAfter of the leaf certificate presented by the target, zero
+	// without TLS
+	CertExpiry time.Time
+}
+
+// phases reported by every probe type, others stay unset
+var probePhases = map[string][]string{
+	typeHTTP: {"resolve", "connect", "tls", "processing", "transfer"},
+	typeTCP:  {"resolve", "connect"},
+	typeTLS:  {"resolve", "connect", "tls"},
+}
+
+// leafExpiry returns the expiry of the certificate presented by the peer
+func leafExpiry(state tls.ConnectionState) time.Time {
+	if len(state.PeerCertificates) == 0 {
+		return time.Time{}
+	}
+	return state.PeerCertificates[0].NotAfter
+}
+
+// unverifiedExpiry returns the expiry of a certificate which failed
+// verification, so expired certificates are still reported
+func unverifiedExpiry(err error) time.Time {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) && len(certErr.UnverifiedCertificates) > 0 {
+		return certErr.UnverifiedCertificates[0].NotAfter
+	}
+	return time.Time{}
+}
+
+// tlsConfig builds the client TLS settings of a probe
+func tlsConfig(probe config.ProbeConfig, host string) *tls.Config {
+	serverName := probe.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: probe.InsecureSkipVerify,
+	}
+}
+
+// dial resolves and connects to a host:port target, timing both phases
+func dial(ctx context.Context, target string, result *probeResult) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	result.Phases["resolve"] = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address found for %s", host)
+	}
+
+	start = time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0].String(), port))
+	result.Phases["connect"] = time.Since(start)
+	return conn, err
+}
+
+// probeTCP connects to the target, and completes a TLS handshake for tls probes
+func probeTCP(ctx context.Context, probe config.ProbeConfig, result *probeResult) error {
+	conn, err := dial(ctx, probe.Target, result)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if probe.Type != typeTLS {
+		return nil
+	}
+
+	host, _, _ := net.SplitHostPort(probe.Target)
+	tlsConn := tls.Client(conn, tlsConfig(probe, host))
+	start := time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	result.Phases["tls"] = time.Since(start)
+	if err != nil {
+		result.CertExpiry = unverifiedExpiry(err)
+		return err
+	}
+	result.CertExpiry = leafExpiry(tlsConn.ConnectionState())
+	return nil
+}
+
+// probeHTTP sends a GET request and checks the status code and body
+func probeHTTP(ctx context.Context, probe config.ProbeConfig, bodyRegex *regexp.Regexp, result *probeResult) error {
+	targetURL, err := url.Parse(probe.Target)
+	if err != nil {
+		return err
+	}
+
+	// hooks may be called concurrently when dialing several addresses, and
+	// after client.Do returned, so they only write these until snapshot
+	var (
+		mutex                                          sync.Mutex
+		dnsStart, connectStart, tlsStart, wroteRequest time.Time
+		phases                                         = make(map[string]time.Duration)
+		certExpiry                                     time.Time
+	)
+	setStart := func(start *time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		*start = time.Now()
+	}
+	setPhase := func(phase string, start *time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		phases[phase] = time.Since(*start)
+	}
+	snapshot := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for phase, duration := range phases {
+			result.Phases[phase] = duration
+		}
+		if !certExpiry.IsZero() {
+			result.CertExpiry = certExpiry
+		}
+	}
+	defer snapshot()
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { setStart(&dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { setPhase("resolve", &dnsStart) },
+		ConnectStart:      func(string, string) { setStart(&connectStart) },
+		ConnectDone:       func(string, string, error) { setPhase("connect", &connectStart) },
+		TLSHandshakeStart: func() { setStart(&tlsStart) },
+		TLSHandshakeDone: func(state tls.ConnectionState, _ error) {
+			setPhase("tls", &tlsStart)
+			mutex.Lock()
+			defer mutex.Unlock()
+			certExpiry = leafExpiry(state)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { setStart(&wroteRequest) },
+		GotFirstResponseByte: func() { setPhase("processing", &wroteRequest) },
+	}
+
+	request, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, targetURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range probe.Headers {
+		request.Header.Set(key, value)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig(probe, targetURL.Hostname()),
+			DisableKeepAlives: true,
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		// replaced by snapshot if the handshake completed
+		result.CertExpiry = unverifiedExpiry(err)
+		return err
+	}
+	defer response.Body.Close()
+
+	start := time.Now()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxBodyBytes))
+	result.Phases["transfer"] = time.Since(start)
+	result.StatusCode = response.StatusCode
+	if err != nil {
+		return fmt.Errorf("failed to read body: %v", err)
+	}
+
+	if !statusExpected(response.StatusCode, probe.ExpectedStatus) {
+		return fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	if bodyRegex != nil && !bodyRegex.Match(body) {
+		return fmt.Errorf("body doesn't match %s", bodyRegex)
+	}
+	return nil
+}
+
+// statusExpected accepts any 2xx code unless expected codes are given
+func statusExpected(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, status := range expected {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// runProbe probes the target once within the probe timeout
+func runProbe(ctx context.Context, probe config.ProbeConfig, bodyRegex *regexp.Regexp) (probeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, probe.Timeout)
+	defer cancel()
+
+	result := probeResult{Phases: make(map[string]time.Duration)}
+	start := time.Now()
+
+	var err error
+	if probe.Type == typeHTTP {
+		err = probeHTTP(ctx, probe, bodyRegex, &result)
+	} else {
+		err = probeTCP(ctx, probe, &result)
+	}
+	result.Duration = time.Since(start)
+	result.Success = err == nil
+	return result, err
+}
+
+// validateProbe checks a probe and compiles its body regex
+func validateProbe(probe config.ProbeConfig) (*regexp.Regexp, error) {
+	if probe.Name == "" || probe.Target == "" {
+		return nil, fmt.Errorf("name and target are required")
+	}
+	switch probe.Type {
+	case typeHTTP:
+		targetURL, err := url.Parse(probe.Target)
+		if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+			return nil, fmt.Errorf("target must be an http or https URL")
+		}
+	case typeTCP, typeTLS:
+		if _, _, err := net.SplitHostPort(probe.Target); err != nil {
+			return nil, fmt.Errorf("target must be host:port: %v", err)
+		}
+		if probe.BodyRegex != "" || len(probe.ExpectedStatus) > 0 {
+			return nil, fmt.Errorf("body_regex and expected_status only apply to http probes")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %q", probe.Type)
+	}
+
+	if probe.BodyRegex == "" {
+		return nil, nil
+	}
+	bodyRegex, err := regexp.Compile(probe.BodyRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body_regex: %v", err)
+	}
+	return bodyRegex, nil
+}
+
+// RegisterProbeMetrics registers probe metrics and returns the usable probes
+// with defaults applied.
+func RegisterProbeMetrics(mc *collector.MetriclyCollector, probes []config.ProbeConfig, interval time.Duration) []config.ProbeConfig {
+	mc.AddMetric("probe_success", "1 if the probe succeeded, 0 otherwise", []string{"probe", "type"})
+	mc.AddMetric("probe_duration_seconds", "Duration of the last probe", []string{"probe", "type"})
+	mc.AddMetric("probe_phase_duration_seconds", "Duration of each phase of the last probe", []string{"probe", "type", "phase"})
+	mc.AddMetric("probe_http_status_code", "HTTP status code of the last probe, 0 if no response was received", []string{"probe"})
+	mc.AddMetric("probe_tls_cert_expiry_timestamp_seconds", "Expiry of the certificate presented by the target as unix timestamp", []string{"probe", "type"})
+
+	var valid []config.ProbeConfig
+	names := make(map[string]bool)
+	for _, probe := range probes {
+		if _, err := validateProbe(probe); err != nil {
+			slog.Error(fmt.Sprintf("skipping probe %q: %v", probe.Name, err))
+			continue
+		}
+		if names[probe.Name] {
+			slog.Error(fmt.Sprintf("skipping probe %q: name is already used", probe.Name))
+			continue
+		}
+		names[probe.Name] = true
+
+		if probe.Interval == 0 {
+			probe.Interval = interval
+		}
+		if probe.Timeout == 0 {
+			probe.Timeout = probe.Interval
+		}
+		valid = append(valid, probe)
+	}
+	return valid
+}
+
+// ReportProbe returns the report function probing a single target. A failed
+// probe is a measurement reported by probe_success, not a failed collection.
+func ReportProbe(probe config.ProbeConfig) func(context.Context, *collector.MetriclyCollector) error {
+	// validated by RegisterProbeMetrics
+	bodyRegex, _ := validateProbe(probe)
+
+	return func(ctx context.Context, mc *collector.MetriclyCollector) error {
+		result, err := runProbe(ctx, probe, bodyRegex)
+		if ctx.Err() != nil {
+			// interrupted by a reload or shutdown, not a failed target
+			return ctx.Err()
+		}
+		if err != nil {
+			slog.Warn(fmt.Sprintf("probe %s failed: %v", probe.Name, err))
+		}
+
+		success := 0.0
+		if result.Success {
+			success = 1
+		}
+		mc.UpdateMetric("probe_success", success, []string{probe.Name, probe.Type})
+		mc.UpdateMetric("probe_duration_seconds", result.Duration.Seconds(), []string{probe.Name, probe.Type})
+		for _, phase := range probePhases[probe.Type] {
+			// phases which weren't reached are reported as 0
+			mc.UpdateMetric("probe_phase_duration_seconds", result.Phases[phase].Seconds(), []string{probe.Name, probe.Type, phase})
+		}
+		if probe.Type == typeHTTP {
+			mc.UpdateMetric("probe_http_status_code", float64(result.StatusCode), []string{probe.Name})
+		}
+		if !result.CertExpiry.IsZero() {
+			mc.UpdateMetric("probe_tls_cert_expiry_timestamp_seconds", float64(result.CertExpiry.Unix()), []string{probe.Name, probe.Type})
+		} else {
+			// a failed probe which got no certificate mustn't keep
+			// exporting the expiry of the previous one
+			mc.DeleteMetric("probe_tls_cert_expiry_timestamp_seconds", []string{probe.Name, probe.Type})
+		}
+
+		slog.Info(fmt.Sprintf("Collected Probe %s metrics in %s", probe.Name, result.Duration))
+		return nil
+	}
+}
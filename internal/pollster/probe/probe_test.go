@@ -0,0 +1,161 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateProbe(t *testing.T) {
+	invalid := []config.ProbeConfig{
+		{Name: "no_target", Type: "http"},
+		{Name: "bad_scheme", Type: "http", Target: "ftp://127.0.0.1/"},
+		{Name: "no_port", Type: "tcp", Target: "127.0.0.1"},
+		{Name: "body_on_tcp", Type: "tcp", Target: "127.0.0.1:22", BodyRegex: "ok"},
+		{Name: "bad_regex", Type: "http", Target: "http://127.0.0.1/", BodyRegex: "(ok"},
+		{Name: "bad_type", Type: "icmp", Target: "127.0.0.1"},
+	}
+	for _, probe := range invalid {
+		if _, err := validateProbe(probe); err == nil {
+			t.Errorf("expected probe %s to be rejected", probe.Name)
+		}
+	}
+
+	mc := collector.CreateMetricCollector()
+	probes := RegisterProbeMetrics(mc, []config.ProbeConfig{
+		{Name: "api", Type: "http", Target: "http://127.0.0.1/"},
+		{Name: "api", Type: "tcp", Target: "127.0.0.1:80"},
+	}, 10*time.Second)
+	if len(probes) != 1 || probes[0].Timeout != 10*time.Second {
+		t.Fatalf("expected a single probe with defaults applied, got %v", probes)
+	}
+}
+
+func TestReportProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Probe") != "metricly" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/healthz" {
+			fmt.Fprint(w, `{"status": "ok"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status": "degraded"}`)
+	}))
+	defer server.Close()
+
+	mc := collector.CreateMetricCollector()
+	probes := RegisterProbeMetrics(mc, []config.ProbeConfig{
+		{Name: "healthy", Type: "http", Target: server.URL + "/healthz", BodyRegex: `"ok"`, Headers: map[string]string{"X-Probe": "metricly"}},
+		{Name: "degraded", Type: "http", Target: server.URL + "/", BodyRegex: `"ok"`, Headers: map[string]string{"X-Probe": "metricly"}},
+		{Name: "forbidden", Type: "http", Target: server.URL + "/healthz"},
+		{Name: "expected_forbidden", Type: "http", Target: server.URL + "/healthz", ExpectedStatus: []int{403}},
+	}, 5*time.Second)
+	for _, probe := range probes {
+		ReportProbe(probe)(context.Background(), mc)
+	}
+
+	helper.VerifyMetric(t, mc, "metricly_probe_success|healthy|http", 1)
+	helper.VerifyMetric(t, mc, "metricly_probe_http_status_code|healthy", 200)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|degraded|http", 0)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|forbidden|http", 0)
+	helper.VerifyMetric(t, mc, "metricly_probe_http_status_code|forbidden", 403)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|expected_forbidden|http", 1)
+
+	for _, phase := range []string{"connect", "processing", "transfer"} {
+		if _, exists := mc.Data["metricly_probe_phase_duration_seconds|healthy|http|"+phase]; !exists {
+			t.Errorf("expected %s phase to be reported", phase)
+		}
+	}
+	if _, exists := mc.Data["metricly_probe_tls_cert_expiry_timestamp_seconds|healthy|http"]; exists {
+		t.Errorf("expected no certificate expiry for plain http")
+	}
+}
+
+func TestReportProbeTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	expiry := float64(server.Certificate().NotAfter.Unix())
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	mc := collector.CreateMetricCollector()
+	probes := RegisterProbeMetrics(mc, []config.ProbeConfig{
+		{Name: "https", Type: "http", Target: server.URL, InsecureSkipVerify: true},
+		{Name: "untrusted", Type: "http", Target: server.URL},
+		{Name: "handshake", Type: "tls", Target: address, InsecureSkipVerify: true},
+	}, 5*time.Second)
+	for _, probe := range probes {
+		ReportProbe(probe)(context.Background(), mc)
+	}
+
+	helper.VerifyMetric(t, mc, "metricly_probe_success|https|http", 1)
+	helper.VerifyMetric(t, mc, "metricly_probe_tls_cert_expiry_timestamp_seconds|https|http", expiry)
+	// the certificate of the test server isn't trusted, its expiry is still reported
+	helper.VerifyMetric(t, mc, "metricly_probe_success|untrusted|http", 0)
+	helper.VerifyMetric(t, mc, "metricly_probe_tls_cert_expiry_timestamp_seconds|untrusted|http", expiry)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|handshake|tls", 1)
+	helper.VerifyMetric(t, mc, "metricly_probe_tls_cert_expiry_timestamp_seconds|handshake|tls", expiry)
+
+	// a probe failing before the handshake doesn't keep the previous expiry
+	server.Close()
+	ReportProbe(probes[2])(context.Background(), mc)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|handshake|tls", 0)
+	if _, exists := mc.Data["metricly_probe_tls_cert_expiry_timestamp_seconds|handshake|tls"]; exists {
+		t.Errorf("expected expiry to be dropped once the target is unreachable")
+	}
+}
+
+func TestReportProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	address := listener.Addr().String()
+
+	// a closed listener leaves a port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	mc := collector.CreateMetricCollector()
+	probes := RegisterProbeMetrics(mc, []config.ProbeConfig{
+		{Name: "open", Type: "tcp", Target: address},
+		{Name: "closed", Type: "tcp", Target: closedAddress},
+		{Name: "not_tls", Type: "tls", Target: address, Timeout: time.Second},
+	}, 5*time.Second)
+	for _, probe := range probes {
+		ReportProbe(probe)(context.Background(), mc)
+	}
+	listener.Close()
+
+	helper.VerifyMetric(t, mc, "metricly_probe_success|open|tcp", 1)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|closed|tcp", 0)
+	helper.VerifyMetric(t, mc, "metricly_probe_success|not_tls|tls", 0)
+	if _, exists := mc.Data["metricly_probe_phase_duration_seconds|open|tcp|connect"]; !exists {
+		t.Errorf("expected connect phase to be reported")
+	}
+}
@@ -0,0 +1,277 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"metricly/internal/pollster/textfile"
+	"metricly/pkg/common"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxOutputBytes = 1 << 20
+	formatPrometheus      = "prometheus"
+	formatJSON            = "json"
+)
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+)
+
+// scriptResult holds the outcome of a single script run
+type scriptResult struct {
+	ExitCode  int
+	Duration  time.Duration
+	Output    []byte
+	Truncated bool
+	TimedOut  bool
+}
+
+// limitedBuffer keeps the first limit bytes written and silently drops the
+// rest, so the script doesn't get SIGPIPE when printing too much
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := lb.limit - lb.buf.Len(); remaining < len(p) {
+		lb.truncated = true
+		if remaining > 0 {
+			lb.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return lb.buf.Write(p)
+}
+
+// runScript runs the command with its environment and working dir, and kills
+// the whole process group once the timeout expires or ctx is cancelled
+func runScript(ctx context.Context, script config.ScriptConfig) (scriptResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, script.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, script.Command[0], script.Command[1:]...)
+	cmd.Dir = script.WorkingDir
+	cmd.Env = os.Environ()
+	for key, value := range script.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// children spawned by the script must not outlive the timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	stdout := &limitedBuffer{limit: script.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: 4096}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	result := scriptResult{
+		ExitCode:  -1,
+		Duration:  time.Since(start),
+		Output:    stdout.buf.Bytes(),
+		Truncated: stdout.truncated,
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	if cmd.ProcessState != nil && !result.TimedOut {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !result.TimedOut {
+		// the command could not be started at all
+		return result, err
+	}
+	if stderr.buf.Len() > 0 {
+		slog.Debug(fmt.Sprintf("script %s stderr: %s", script.Name, stderr.buf.String()))
+	}
+	return result, nil
+}
+
+// flattenJSON turns nested objects into dot separated keys, keeping numbers
+// and booleans only. Dots become underscores in metric names.
+func flattenJSON(prefix string, value interface{}, result map[string]float64) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenJSON(name, nested, result)
+		}
+	case float64:
+		result[prefix] = v
+	case bool:
+		result[prefix] = 0
+		if v {
+			result[prefix] = 1
+		}
+	}
+}
+
+// parseJSONOutput converts a JSON object into gauges named after its keys
+func parseJSONOutput(output []byte, scriptName string) ([]prometheus.Metric, error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse json output: %v", err)
+	}
+
+	values := make(map[string]float64)
+	flattenJSON("", parsed, values)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var metrics []prometheus.Metric
+	// cleaned names may collide, e.g. "a-b" and "a_b" or "a.b" and "a_b"
+	originals := make(map[string]string)
+	for _, key := range keys {
+		name := invalidNameChars.ReplaceAllString(key, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		if other, exists := originals[name]; exists {
+			return nil, fmt.Errorf("keys %q and %q both map to metric %s", other, key, name)
+		}
+		originals[name] = key
+		desc := prometheus.NewDesc(
+			name,
+			"Value reported by a metricly script",
+			nil,
+			prometheus.Labels{"hostname": common.GetHostname(), "script": scriptName},
+		)
+		metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, values[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", key, err)
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// parseOutput converts script output into metrics labelled with the script name
+func parseOutput(output []byte, script config.ScriptConfig) ([]prometheus.Metric, error) {
+	if script.Format == formatJSON {
+		return parseJSONOutput(output, script.Name)
+	}
+
+	families, err := textfile.ParseFamilies(bytes.NewReader(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prometheus output: %v", err)
+	}
+	for name := range families {
+		if strings.HasPrefix(name, "metricly_") {
+			return nil, fmt.Errorf("metric %s clashes with metricly's own metrics", name)
+		}
+	}
+	return textfile.ConvertFamilies(families, map[string]string{"script": script.Name})
+}
+
+// withDefaults fills in unset script settings
+func withDefaults(script config.ScriptConfig, interval time.Duration) config.ScriptConfig {
+	if script.Interval == 0 {
+		script.Interval = interval
+	}
+	if script.Timeout == 0 {
+		script.Timeout = script.Interval
+	}
+	if script.MaxOutputBytes == 0 {
+		script.MaxOutputBytes = defaultMaxOutputBytes
+	}
+	if script.Format == "" {
+		script.Format = formatPrometheus
+	}
+	return script
+}
+
+// RegisterScriptMetrics registers metrics describing script runs and returns
+// the usable scripts with defaults applied.
+func RegisterScriptMetrics(mc *collector.MetriclyCollector, scripts []config.ScriptConfig, interval time.Duration) []config.ScriptConfig {
+	mc.AddMetric("script_success", "1 if the script exited with 0 and its output was parsed, 0 otherwise", []string{"script"})
+	mc.AddMetric("script_exit_code", "Exit code of the last script run, -1 if it timed out or could not start", []string{"script"})
+	mc.AddMetric("script_duration_seconds", "Duration of the last script run", []string{"script"})
+
+	var valid []config.ScriptConfig
+	for _, script := range scripts {
+		if script.Name == "" || len(script.Command) == 0 {
+			slog.Error(fmt.Sprintf("skipping script %q: name and command are required", script.Name))
+			continue
+		}
+		if script.Format != "" && script.Format != formatPrometheus && script.Format != formatJSON {
+			slog.Error(fmt.Sprintf("skipping script %s: unsupported format %s", script.Name, script.Format))
+			continue
+		}
+		valid = append(valid, withDefaults(script, interval))
+	}
+	return valid
+}
+
+// ReportScript returns the report function running a single script.
+func ReportScript(script config.ScriptConfig) func(context.Context, *collector.MetriclyCollector) error {
+	source := fmt.Sprintf("script_%s", script.Name)
+
+	return func(ctx context.Context, mc *collector.MetriclyCollector) error {
+		result, err := runScript(ctx, script)
+		if ctx.Err() != nil {
+			// interrupted by a reload or shutdown, previous values are kept
+			return ctx.Err()
+		}
+		switch {
+		case err != nil:
+			err = fmt.Errorf("failed to run script %s: %v", script.Name, err)
+		case result.TimedOut:
+			err = fmt.Errorf("script %s timed out after %s", script.Name, script.Timeout)
+		case result.Truncated:
+			err = fmt.Errorf("script %s output exceeds %d bytes, discarding it", script.Name, script.MaxOutputBytes)
+		case result.ExitCode != 0:
+			err = fmt.Errorf("script %s exited with %d", script.Name, result.ExitCode)
+		default:
+			var metrics []prometheus.Metric
+			if metrics, err = parseOutput(result.Output, script); err == nil {
+				err = mc.SetMetrics(source, metrics)
+			}
+			if err != nil {
+				err = fmt.Errorf("script %s: %v", script.Name, err)
+			}
+		}
+
+		success := 1.0
+		if err != nil {
+			success = 0
+			// don't keep exporting values of a failing script
+			mc.SetMetrics(source, nil)
+		}
+
+		mc.UpdateMetric("script_success", success, []string{script.Name})
+		mc.UpdateMetric("script_exit_code", float64(result.ExitCode), []string{script.Name})
+		mc.UpdateMetric("script_duration_seconds", result.Duration.Seconds(), []string{script.Name})
+
+		slog.Info(fmt.Sprintf("Collected Script %s metrics in %s", script.Name, result.Duration))
+		return err
+	}
+}
@@ -0,0 +1,188 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterScriptMetrics(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{
+		{Name: "valid", Command: []string{"true"}},
+		{Name: "no_command"},
+		{Name: "bad_format", Command: []string{"true"}, Format: "xml"},
+	}, 10*time.Second)
+
+	if len(scripts) != 1 {
+		t.Fatalf("expected 1 valid script, got %d", len(scripts))
+	}
+	if scripts[0].Interval != 10*time.Second || scripts[0].Timeout != 10*time.Second {
+		t.Errorf("expected interval and timeout to default to 10s, got %s/%s", scripts[0].Interval, scripts[0].Timeout)
+	}
+	if scripts[0].Format != formatPrometheus || scripts[0].MaxOutputBytes != defaultMaxOutputBytes {
+		t.Errorf("unexpected defaults: %+v", scripts[0])
+	}
+}
+
+func TestReportScriptPrometheusOutput(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+	dir := t.TempDir()
+
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{{
+		Name: "raid",
+		Command: []string{"sh", "-c", `echo "# TYPE raid_array_ok gauge"
+echo "raid_array_ok{array=\"md0\"} $RAID_OK"
+echo "raid_working_dir_ok $(test "$(pwd)" = "$EXPECTED_DIR" && echo 1 || echo 0)"`},
+		Env:        map[string]string{"RAID_OK": "1", "EXPECTED_DIR": dir},
+		WorkingDir: dir,
+	}}, 10*time.Second)
+
+	if err := ReportScript(scripts[0])(context.Background(), mc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	helper.VerifyMetric(t, mc, "metricly_script_success|raid", 1)
+	helper.VerifyMetric(t, mc, "metricly_script_exit_code|raid", 0)
+	helper.VerifyGatheredMetric(t, mc, "raid_array_ok", map[string]string{"array": "md0", "script": "raid", "hostname": "testhost"}, 1)
+	helper.VerifyGatheredMetric(t, mc, "raid_working_dir_ok", map[string]string{"script": "raid"}, 1)
+}
+
+func TestReportScriptJSONOutput(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{{
+		Name:    "queue",
+		Command: []string{"echo", `{"queue_depth": 4, "healthy": true, "workers": {"busy": 3}, "version": "1.2"}`},
+		Format:  formatJSON,
+	}}, 10*time.Second)
+
+	ReportScript(scripts[0])(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_script_success|queue", 1)
+	helper.VerifyGatheredMetric(t, mc, "queue_depth", map[string]string{"script": "queue"}, 4)
+	helper.VerifyGatheredMetric(t, mc, "healthy", map[string]string{"script": "queue"}, 1)
+	helper.VerifyGatheredMetric(t, mc, "workers_busy", map[string]string{"script": "queue"}, 3)
+	if _, exists := helper.GatherMetrics(t, mc)["version"]; exists {
+		t.Errorf("expected string values to be ignored")
+	}
+}
+
+func TestReportScriptJSONKeyCollision(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{
+		{Name: "dashes", Command: []string{"echo", `{"a-b": 1, "a_b": 2}`}, Format: formatJSON},
+		{Name: "nested", Command: []string{"echo", `{"a": {"b": 1}, "a_b": 2}`}, Format: formatJSON},
+	}, 10*time.Second)
+	original := map[string]string{"dashes": `"a-b"`, "nested": `"a.b"`}
+
+	for _, script := range scripts {
+		err := ReportScript(script)(context.Background(), mc)
+		if err == nil || !strings.Contains(err.Error(), `"a_b"`) || !strings.Contains(err.Error(), original[script.Name]) {
+			t.Errorf("expected colliding keys to fail script %s, got %v", script.Name, err)
+		}
+		helper.VerifyMetric(t, mc, "metricly_script_success|"+script.Name, 0)
+	}
+	if _, exists := helper.GatherMetrics(t, mc)["a_b"]; exists {
+		t.Errorf("expected output with colliding keys to be discarded")
+	}
+}
+
+func TestReportScriptFailures(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{
+		{Name: "timeout", Command: []string{"sh", "-c", "sleep 5 & wait"}, Timeout: 100 * time.Millisecond},
+		{Name: "failing", Command: []string{"sh", "-c", "echo 'partial 1'; exit 3"}},
+		{Name: "verbose", Command: []string{"sh", "-c", "echo 'some_metric 1'; echo 'other_metric 2'"}, MaxOutputBytes: 16},
+		{Name: "missing", Command: []string{"/nonexistent/metricly-script"}},
+	}, 10*time.Second)
+
+	start := time.Now()
+	ReportScript(scripts[0])(context.Background(), mc)
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("expected timed out script to be killed, took %s", time.Since(start))
+	}
+	helper.VerifyMetric(t, mc, "metricly_script_success|timeout", 0)
+	helper.VerifyMetric(t, mc, "metricly_script_exit_code|timeout", -1)
+
+	if err := ReportScript(scripts[1])(context.Background(), mc); err == nil || !strings.Contains(err.Error(), "exited with 3") {
+		t.Errorf("expected failing script to fail the collection, got %v", err)
+	}
+	helper.VerifyMetric(t, mc, "metricly_script_success|failing", 0)
+	helper.VerifyMetric(t, mc, "metricly_script_exit_code|failing", 3)
+
+	ReportScript(scripts[2])(context.Background(), mc)
+	helper.VerifyMetric(t, mc, "metricly_script_success|verbose", 0)
+	helper.VerifyMetric(t, mc, "metricly_script_exit_code|verbose", 0)
+
+	ReportScript(scripts[3])(context.Background(), mc)
+	helper.VerifyMetric(t, mc, "metricly_script_success|missing", 0)
+	helper.VerifyMetric(t, mc, "metricly_script_exit_code|missing", -1)
+
+	families := helper.GatherMetrics(t, mc)
+	for _, name := range []string{"partial", "some_metric"} {
+		if _, exists := families[name]; exists {
+			t.Errorf("expected output of failed script to be discarded, found %s", name)
+		}
+	}
+}
+
+func TestReportScriptCancelled(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{
+		{Name: "slow", Command: []string{"sh", "-c", "sleep 5 & wait"}, Timeout: time.Minute},
+	}, 10*time.Second)
+
+	// stopping pollsters kills the script instead of waiting for its timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if err := ReportScript(scripts[0])(ctx, mc); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled collection, got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("expected cancelled script to be killed, took %s", time.Since(start))
+	}
+	if _, exists := mc.Data["metricly_script_success|slow"]; exists {
+		t.Errorf("expected an interrupted script not to be reported as failed")
+	}
+}
+
+func TestReportScriptSharedMetrics(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+	scripts := RegisterScriptMetrics(mc, []config.ScriptConfig{
+		{Name: "first", Command: []string{"echo", `{"ok": 1}`}, Format: formatJSON},
+		{Name: "second", Command: []string{"echo", `{"ok": 0}`}, Format: formatJSON},
+		{Name: "other_help", Command: []string{"sh", "-c", "echo '# HELP ok Something else'; echo 'ok 1'"}},
+		{Name: "duplicate", Command: []string{"sh", "-c", "echo 'dup 1'; echo 'dup 2'"}},
+	}, 10*time.Second)
+
+	// series of several scripts differ by their script label
+	for _, script := range scripts[:2] {
+		if err := ReportScript(script)(context.Background(), mc); err != nil {
+			t.Fatalf("unexpected error for script %s: %v", script.Name, err)
+		}
+	}
+	helper.VerifyGatheredMetric(t, mc, "ok", map[string]string{"script": "first"}, 1)
+	helper.VerifyGatheredMetric(t, mc, "ok", map[string]string{"script": "second"}, 0)
+
+	if err := ReportScript(scripts[2])(context.Background(), mc); err == nil || !strings.Contains(err.Error(), "help") {
+		t.Errorf("expected help mismatch to fail the script, got %v", err)
+	}
+	helper.VerifyMetric(t, mc, "metricly_script_success|other_help", 0)
+
+	if err := ReportScript(scripts[3])(context.Background(), mc); err == nil || !strings.Contains(err.Error(), "reported twice") {
+		t.Errorf("expected duplicate series to fail the script, got %v", err)
+	}
+	helper.VerifyMetric(t, mc, "metricly_script_success|duplicate", 0)
+
+	families := helper.GatherMetrics(t, mc)
+	if _, exists := families["dup"]; exists {
+		t.Errorf("expected duplicate series to be discarded")
+	}
+}
@@ -0,0 +1,250 @@
+//go:build linux
+
+package sysinfo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	procUptime    = "/proc/uptime"
+	procStat      = "/proc/stat"
+	etcOSRelease  = "/etc/os-release"
+	etcMachineID  = "/etc/machine-id"
+	sysClassDMI   = "/sys/class/dmi/id"
+	osReleaseLibs = "/usr/lib/os-release"
+
+	// replaced in tests
+	uname = syscall.Uname
+
+	nodeInfoLabels = []string{
+		"kernel_release",
+		"kernel_version",
+		"machine",
+		"os_id",
+		"os_name",
+		"os_version_id",
+		"os_pretty_name",
+		"machine_id",
+		"product_vendor",
+		"product_name",
+		"product_version",
+		"bios_version",
+	}
+)
+
+type nodeInfo struct {
+	KernelRelease  string
+	KernelVersion  string
+	Machine        string
+	OSID           string
+	OSName         string
+	OSVersionID    string
+	OSPrettyName   string
+	MachineID      string
+	ProductVendor  string
+	ProductName    string
+	ProductVersion string
+	BIOSVersion    string
+}
+
+// labels returns label values in the order of nodeInfoLabels
+func (ni nodeInfo) labels() []string {
+	return []string{
+		ni.KernelRelease,
+		ni.KernelVersion,
+		ni.Machine,
+		ni.OSID,
+		ni.OSName,
+		ni.OSVersionID,
+		ni.OSPrettyName,
+		ni.MachineID,
+		ni.ProductVendor,
+		ni.ProductName,
+		ni.ProductVersion,
+		ni.BIOSVersion,
+	}
+}
+
+// utsnameToString converts the NUL terminated arrays of syscall.Utsname,
+// which are signed or unsigned depending on the architecture
+func utsnameToString[T int8 | uint8](field [65]T) string {
+	var sb strings.Builder
+	for _, c := range field {
+		if c == 0 {
+			break
+		}
+		sb.WriteByte(byte(c))
+	}
+	return sb.String()
+}
+
+// readOSRelease parses KEY=value pairs of os-release(5)
+func readOSRelease() (map[string]string, error) {
+
+	if etcOSReleaseEnv := os.Getenv("ETC_OS_RELEASE"); etcOSReleaseEnv != "" {
+		etcOSRelease = etcOSReleaseEnv
+	}
+
+	file, err := os.Open(etcOSRelease)
+	if os.IsNotExist(err) && os.Getenv("ETC_OS_RELEASE") == "" {
+		// /etc/os-release is optional, /usr/lib/os-release is the fallback
+		file, err = os.Open(osReleaseLibs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open os-release: %v", err)
+	}
+	defer file.Close()
+
+	release := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		release[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", etcOSRelease, err)
+	}
+	return release, nil
+}
+
+// readNodeInfo gathers kernel, OS, machine ID and DMI identifiers
+func readNodeInfo() (nodeInfo, error) {
+
+	if etcMachineIDEnv := os.Getenv("ETC_MACHINE_ID"); etcMachineIDEnv != "" {
+		etcMachineID = etcMachineIDEnv
+	}
+	if sysClassDMIEnv := os.Getenv("SYS_CLASS_DMI"); sysClassDMIEnv != "" {
+		sysClassDMI = sysClassDMIEnv
+	}
+
+	var uts syscall.Utsname
+	if err := uname(&uts); err != nil {
+		return nodeInfo{}, fmt.Errorf("failed to call uname: %v", err)
+	}
+
+	info := nodeInfo{
+		KernelRelease: utsnameToString(uts.Release),
+		KernelVersion: utsnameToString(uts.Version),
+		Machine:       utsnameToString(uts.Machine),
+	}
+
+	release, err := readOSRelease()
+	if err != nil {
+		slog.Warn(fmt.Sprint(err))
+	}
+	info.OSID = release["ID"]
+	info.OSName = release["NAME"]
+	info.OSVersionID = release["VERSION_ID"]
+	info.OSPrettyName = release["PRETTY_NAME"]
+
+	// all of these are optional, DMI is missing on most ARM boards
+	info.MachineID, _ = common.ReadSysfsValue(etcMachineID)
+	info.ProductVendor, _ = common.ReadSysfsValue(filepath.Join(sysClassDMI, "sys_vendor"))
+	info.ProductName, _ = common.ReadSysfsValue(filepath.Join(sysClassDMI, "product_name"))
+	info.ProductVersion, _ = common.ReadSysfsValue(filepath.Join(sysClassDMI, "product_version"))
+	info.BIOSVersion, _ = common.ReadSysfsValue(filepath.Join(sysClassDMI, "bios_version"))
+
+	return info, nil
+}
+
+// readUptime reads seconds since boot from the first field of /proc/uptime
+func readUptime() (float64, error) {
+
+	if procUptimeEnv := os.Getenv("PROC_UPTIME"); procUptimeEnv != "" {
+		procUptime = procUptimeEnv
+	}
+
+	content, err := common.ReadSysfsValue(procUptime)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(content)
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("unexpected format in %s", procUptime)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readBootTime reads the btime line of /proc/stat
+func readBootTime() (uint64, error) {
+
+	if procStatEnv := os.Getenv("PROC_CPU_STAT"); procStatEnv != "" {
+		procStat = procStatEnv
+	}
+
+	file, err := os.Open(procStat)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			return common.ParseUint(fields[1]), nil
+		}
+	}
+	return 0, fmt.Errorf("btime not found in %s", procStat)
+}
+
+func RegisterSysinfoMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("node_info", "Kernel, OS and hardware identifiers of the node, value is always 1", nodeInfoLabels)
+	mc.AddMetric("node_uptime_seconds", "Seconds since the node booted", []string{})
+	mc.AddMetric("node_boot_time_seconds", "Node boot time as unix timestamp", []string{})
+}
+
+// ReportSysinfo reports node identifiers, uptime and boot time.
+func ReportSysinfo(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	var errs []error
+	info, err := readNodeInfo()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		// drop the previous series in case an upgrade changed the OS version
+		mc.ReplaceMetric("node_info", []collector.Series{{Value: 1, Labels: info.labels()}})
+	}
+
+	if uptime, err := readUptime(); err == nil {
+		mc.UpdateMetric("node_uptime_seconds", uptime, []string{})
+	} else {
+		errs = append(errs, fmt.Errorf("failed to read uptime: %v", err))
+	}
+
+	if bootTime, err := readBootTime(); err == nil {
+		mc.UpdateMetric("node_boot_time_seconds", float64(bootTime), []string{})
+	} else {
+		errs = append(errs, fmt.Errorf("failed to read boot time: %v", err))
+	}
+
+	slog.Info(fmt.Sprintf("Collected System info metrics in %s", time.Since(start)))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sysinfo
+
+import (
+	"context"
+	"log/slog"
+	collector "metricly/internal/collector"
+)
+
+// RegisterSysinfoMetrics registers nothing, uname and /proc are Linux only
+func RegisterSysinfoMetrics(mc *collector.MetriclyCollector) {
+	slog.Warn("System info metrics are only supported on Linux")
+}
+
+// ReportSysinfo reports nothing outside of Linux.
+func ReportSysinfo(ctx context.Context, mc *collector.MetriclyCollector) error { return nil }
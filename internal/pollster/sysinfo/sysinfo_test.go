@@ -0,0 +1,113 @@
+//go:build linux
+
+package sysinfo
+
+import (
+	"context"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func mockUname(uts *syscall.Utsname) error {
+	setUtsname(&uts.Release, "6.11.4-301.fc41.x86_64")
+	setUtsname(&uts.Version, "#1 SMP PREEMPT_DYNAMIC")
+	setUtsname(&uts.Machine, "x86_64")
+	return nil
+}
+
+// setUtsname fills a field of syscall.Utsname, signed or unsigned depending
+// on the architecture
+func setUtsname[T int8 | uint8](field *[65]T, s string) {
+	for i := range len(s) {
+		field[i] = T(s[i])
+	}
+}
+
+func setupSysinfoSources(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"etc/os-release": `NAME="Fedora Linux"
+VERSION="41 (Server Edition)"
+ID=fedora
+VERSION_ID=41
+PRETTY_NAME="Fedora Linux 41 (Server Edition)"
+# comments are ignored
+`,
+		"etc/machine-id":                "5e2a4ad1b7f34c5e8b2e0c7d9a3f6b21\n",
+		"sys/class/dmi/id/sys_vendor":   "Dell Inc.\n",
+		"sys/class/dmi/id/product_name": "PowerEdge R750\n",
+		"sys/class/dmi/id/bios_version": "1.13.2\n",
+		"proc/uptime":                   "354120.55 2800123.10\n",
+		"proc/stat":                     "cpu  2255 34 2290 22625563 6290 127 456 0 0 0\nbtime 1729324800\nprocesses 52312\n",
+	})
+
+	tmpOSRelease, tmpMachineID, tmpDMI := etcOSRelease, etcMachineID, sysClassDMI
+	tmpUptime, tmpStat, tmpUname := procUptime, procStat, uname
+	t.Cleanup(func() {
+		etcOSRelease, etcMachineID, sysClassDMI = tmpOSRelease, tmpMachineID, tmpDMI
+		procUptime, procStat, uname = tmpUptime, tmpStat, tmpUname
+	})
+
+	etcOSRelease = filepath.Join(root, "etc/os-release")
+	etcMachineID = filepath.Join(root, "etc/machine-id")
+	sysClassDMI = filepath.Join(root, "sys/class/dmi/id")
+	procUptime = filepath.Join(root, "proc/uptime")
+	procStat = filepath.Join(root, "proc/stat")
+	uname = mockUname
+}
+
+func TestReadNodeInfo(t *testing.T) {
+	setupSysinfoSources(t)
+
+	info, err := readNodeInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := nodeInfo{
+		KernelRelease: "6.11.4-301.fc41.x86_64",
+		KernelVersion: "#1 SMP PREEMPT_DYNAMIC",
+		Machine:       "x86_64",
+		OSID:          "fedora",
+		OSName:        "Fedora Linux",
+		OSVersionID:   "41",
+		OSPrettyName:  "Fedora Linux 41 (Server Edition)",
+		MachineID:     "5e2a4ad1b7f34c5e8b2e0c7d9a3f6b21",
+		ProductVendor: "Dell Inc.",
+		ProductName:   "PowerEdge R750",
+		BIOSVersion:   "1.13.2",
+	}
+	if info != expected {
+		t.Errorf("unexpected node info:\n got %+v\nwant %+v", info, expected)
+	}
+}
+
+func TestReportSysinfo(t *testing.T) {
+	setupSysinfoSources(t)
+
+	mc := collector.CreateMetricCollector()
+	RegisterSysinfoMetrics(mc)
+
+	ReportSysinfo(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_node_uptime_seconds", 354120.55)
+	helper.VerifyMetric(t, mc, "metricly_node_boot_time_seconds", 1729324800)
+
+	info, _ := readNodeInfo()
+	infoKey := "metricly_node_info|" + strings.Join(info.labels(), "|")
+	helper.VerifyMetric(t, mc, infoKey, 1)
+
+	// a changed OS version must replace the previous info series
+	etcOSRelease = filepath.Join(t.TempDir(), "os-release")
+	if err := helper.SetupCollectorSources(etcOSRelease, "ID=fedora\nVERSION_ID=42\n"); err != nil {
+		t.Fatalf("failed to setup collector file: %v", err)
+	}
+	ReportSysinfo(context.Background(), mc)
+
+	if _, exists := mc.Data[infoKey]; exists {
+		t.Errorf("stale node_info series was not removed")
+	}
+}
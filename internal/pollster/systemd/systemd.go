@@ -0,0 +1,252 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	systemdDestination = "org.freedesktop.systemd1"
+	systemdPath        = "/org/freedesktop/systemd1"
+
+	// a bus call taking longer means systemd is stuck, which must not stall
+	// the pollster
+	callTimeout = 10 * time.Second
+)
+
+var (
+	systemdDbusSocket = "/run/dbus/system_bus_socket"
+
+	// every ActiveState a unit can be in, see systemd.unit(5)
+	activeStates = []string{"active", "reloading", "inactive", "failed", "activating", "deactivating"}
+
+	conn        *dbus.Conn
+	unitInclude *regexp.Regexp
+	unitExclude *regexp.Regexp
+)
+
+// unitStatus holds the state of a unit as listed by systemd
+type unitStatus struct {
+	Name        string
+	Type        string
+	ActiveState string
+	SubState    string
+	Path        dbus.ObjectPath
+	// unknown if systemd didn't tell, e.g. before systemd 235
+	Restarts      uint32
+	RestartsKnown bool
+}
+
+// listedUnit matches the a(ssssssouso) signature returned by ListUnits
+type listedUnit struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Followed    string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// connect opens a private connection to the system bus
+func connect() (*dbus.Conn, error) {
+	if socketEnv := os.Getenv("SYSTEMD_DBUS_SOCKET"); socketEnv != "" {
+		systemdDbusSocket = socketEnv
+	}
+
+	socket, err := net.DialTimeout("unix", systemdDbusSocket, callTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus at %s: %v", systemdDbusSocket, err)
+	}
+	// authentication and Hello have no timeout of their own
+	socket.SetDeadline(time.Now().Add(callTimeout))
+
+	busConn, err := dbus.NewConn(socket)
+	if err == nil {
+		if err = busConn.Auth(nil); err == nil {
+			err = busConn.Hello()
+		}
+	}
+	if err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("failed to connect to system bus at %s: %v", systemdDbusSocket, err)
+	}
+	socket.SetDeadline(time.Time{})
+	return busConn, nil
+}
+
+// compileUnitRegex anchors a unit regex so it matches whole unit names
+func compileUnitRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// unitSelected applies include and exclude regexes to a unit name
+func unitSelected(name string) bool {
+	if unitInclude != nil && !unitInclude.MatchString(name) {
+		return false
+	}
+	return unitExclude == nil || !unitExclude.MatchString(name)
+}
+
+// readRestarts reads NRestarts of a service, which only exists since
+// systemd 235
+func readRestarts(ctx context.Context, busConn *dbus.Conn, path dbus.ObjectPath) (uint32, error) {
+	// every call gets its own timeout, so a slow unit doesn't fail the
+	// remaining ones
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	var restarts dbus.Variant
+	err := busConn.Object(systemdDestination, path).
+		CallWithContext(ctx, "org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.systemd1.Service", "NRestarts").
+		Store(&restarts)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := restarts.Value().(uint32)
+	if !ok {
+		return 0, fmt.Errorf("unexpected NRestarts type %s", restarts.Signature())
+	}
+	return value, nil
+}
+
+// readUnitStatus lists units loaded by systemd, along with restart counts of
+// services
+func readUnitStatus(ctx context.Context, busConn *dbus.Conn) ([]unitStatus, error) {
+	listCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	var listed []listedUnit
+	manager := busConn.Object(systemdDestination, systemdPath)
+	if err := manager.CallWithContext(listCtx, "org.freedesktop.systemd1.Manager.ListUnits", 0).Store(&listed); err != nil {
+		return nil, fmt.Errorf("failed to list systemd units: %v", err)
+	}
+
+	var units []unitStatus
+	for _, unit := range listed {
+		if err := ctx.Err(); err != nil {
+			// pollsters are stopping
+			return nil, err
+		}
+		if !unitSelected(unit.Name) {
+			continue
+		}
+
+		status := unitStatus{
+			Name:        unit.Name,
+			ActiveState: unit.ActiveState,
+			SubState:    unit.SubState,
+			Path:        unit.Path,
+		}
+		if dot := strings.LastIndex(unit.Name, "."); dot >= 0 {
+			status.Type = unit.Name[dot+1:]
+		}
+
+		if status.Type == "service" {
+			restarts, err := readRestarts(ctx, busConn, unit.Path)
+			if err == nil {
+				status.Restarts = restarts
+				status.RestartsKnown = true
+			} else {
+				slog.Debug(fmt.Sprintf("failed to get restarts of %s: %v", unit.Name, err))
+			}
+		}
+		units = append(units, status)
+	}
+	return units, nil
+}
+
+// RegisterSystemdMetrics registers systemd metrics and connects to the
+// system bus. It returns false if the collector is disabled or the bus
+// can't be reached, in which case the collector must not be started.
+func RegisterSystemdMetrics(mc *collector.MetriclyCollector, systemd config.SystemdConfig) bool {
+	if !systemd.Enabled {
+		return false
+	}
+
+	var err error
+	if unitInclude, err = compileUnitRegex(systemd.UnitInclude); err != nil {
+		slog.Error(fmt.Sprintf("disabling systemd collector, invalid unit_include: %v", err))
+		return false
+	}
+	if unitExclude, err = compileUnitRegex(systemd.UnitExclude); err != nil {
+		slog.Error(fmt.Sprintf("disabling systemd collector, invalid unit_exclude: %v", err))
+		return false
+	}
+
+	if conn != nil {
+		conn.Close()
+	}
+	if conn, err = connect(); err != nil {
+		slog.Warn(fmt.Sprintf("disabling systemd collector: %v", err))
+		return false
+	}
+
+	mc.AddMetric("systemd_unit_state", "1 for the current active state of the unit, 0 for others", []string{"unit", "type", "state"})
+	mc.AddMetric("systemd_unit_sub_state", "Current low-level state of the unit, always 1", []string{"unit", "type", "sub_state"})
+	mc.AddMetric("systemd_service_restarts_total", "Number of automatic restarts of the service by systemd", []string{"unit"})
+	mc.AddMetric("systemd_units", "Number of units per active state", []string{"state"})
+	return true
+}
+
+// ReportSystemdUnits reports unit states read from systemd.
+func ReportSystemdUnits(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	// systemd or the bus may have been restarted since the last collection
+	if conn == nil || !conn.Connected() {
+		var err error
+		if conn, err = connect(); err != nil {
+			return err
+		}
+	}
+
+	units, err := readUnitStatus(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	var unitStates, subStates, restarts []collector.Series
+	counts := make(map[string]int)
+	for _, unit := range units {
+		for _, state := range activeStates {
+			value := 0.0
+			if unit.ActiveState == state {
+				value = 1
+			}
+			unitStates = append(unitStates, collector.Series{Value: value, Labels: []string{unit.Name, unit.Type, state}})
+		}
+		subStates = append(subStates, collector.Series{Value: 1, Labels: []string{unit.Name, unit.Type, unit.SubState}})
+		// a missing count must not look like a counter reset
+		if unit.RestartsKnown {
+			restarts = append(restarts, collector.Series{Value: float64(unit.Restarts), Labels: []string{unit.Name}})
+		}
+		counts[unit.ActiveState]++
+	}
+	// units are loaded and garbage collected between collections
+	mc.ReplaceMetric("systemd_unit_state", unitStates)
+	mc.ReplaceMetric("systemd_unit_sub_state", subStates)
+	mc.ReplaceMetric("systemd_service_restarts_total", restarts)
+	for _, state := range activeStates {
+		mc.UpdateMetric("systemd_units", float64(counts[state]), []string{state})
+	}
+
+	slog.Info(fmt.Sprintf("Collected Systemd metrics in %s", time.Since(start)))
+	return nil
+}
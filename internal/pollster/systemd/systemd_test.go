@@ -0,0 +1,194 @@
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+var fakeUnits = []listedUnit{
+	{Name: "sshd.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/org/freedesktop/systemd1/unit/sshd_2eservice", JobPath: "/"},
+	{Name: "crond.service", LoadState: "loaded", ActiveState: "failed", SubState: "failed", Path: "/org/freedesktop/systemd1/unit/crond_2eservice", JobPath: "/"},
+	{Name: "logrotate.timer", LoadState: "loaded", ActiveState: "active", SubState: "waiting", Path: "/org/freedesktop/systemd1/unit/logrotate_2etimer", JobPath: "/"},
+	{Name: "user@1000.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/org/freedesktop/systemd1/unit/user_401000_2eservice", JobPath: "/"},
+	{Name: "home.mount", LoadState: "loaded", ActiveState: "active", SubState: "mounted", Path: "/org/freedesktop/systemd1/unit/home_2emount", JobPath: "/"},
+}
+
+var fakeRestarts = map[dbus.ObjectPath]uint32{
+	"/org/freedesktop/systemd1/unit/sshd_2eservice":  0,
+	"/org/freedesktop/systemd1/unit/crond_2eservice": 5,
+}
+
+// startFakeBus serves the few systemd calls used by the pollster on a unix
+// socket, speaking the D-Bus wire protocol without a bus daemon
+func startFakeBus(t *testing.T) string {
+	socket := filepath.Join(t.TempDir(), "system_bus_socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeBus(conn)
+		}
+	}()
+	return socket
+}
+
+func serveFakeBus(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// SASL handshake, see "Authentication Protocol" in the D-Bus specification
+	if _, err := reader.ReadByte(); err != nil {
+		return
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "AUTH":
+			conn.Write([]byte("REJECTED EXTERNAL\r\n"))
+		case strings.HasPrefix(line, "AUTH EXTERNAL"):
+			conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+		case line == "NEGOTIATE_UNIX_FD":
+			conn.Write([]byte("ERROR\r\n"))
+		case line == "BEGIN":
+			serveFakeMessages(conn, reader)
+			return
+		default:
+			conn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+func serveFakeMessages(conn net.Conn, reader *bufio.Reader) {
+	for {
+		msg, err := dbus.DecodeMessage(reader)
+		if err != nil {
+			return
+		}
+		member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+		path, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+
+		var body []interface{}
+		switch member {
+		case "Hello":
+			body = []interface{}{":1.42"}
+		case "ListUnits":
+			body = []interface{}{fakeUnits}
+		case "Get":
+			restarts, exists := fakeRestarts[path]
+			if !exists {
+				sendFakeError(conn, msg, "org.freedesktop.DBus.Error.UnknownProperty")
+				continue
+			}
+			body = []interface{}{dbus.MakeVariant(restarts)}
+		default:
+			sendFakeError(conn, msg, "org.freedesktop.DBus.Error.UnknownMethod")
+			continue
+		}
+
+		reply := &dbus.Message{
+			Type: dbus.TypeMethodReply,
+			Headers: map[dbus.HeaderField]dbus.Variant{
+				dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+				dbus.FieldSignature:   dbus.MakeVariant(dbus.SignatureOf(body...)),
+			},
+			Body: body,
+		}
+		if err := reply.EncodeTo(conn, binary.LittleEndian); err != nil {
+			return
+		}
+	}
+}
+
+func sendFakeError(conn net.Conn, msg *dbus.Message, name string) {
+	reply := &dbus.Message{
+		Type: dbus.TypeError,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+			dbus.FieldErrorName:   dbus.MakeVariant(name),
+		},
+	}
+	reply.EncodeTo(conn, binary.LittleEndian)
+}
+
+func TestReportSystemdUnits(t *testing.T) {
+	t.Setenv("SYSTEMD_DBUS_SOCKET", startFakeBus(t))
+
+	mc := collector.CreateMetricCollector()
+	if !RegisterSystemdMetrics(mc, config.SystemdConfig{
+		Enabled:     true,
+		UnitInclude: `.+\.(service|timer)`,
+		UnitExclude: `user@.+\.service`,
+	}) {
+		t.Fatalf("expected systemd collector to be enabled")
+	}
+	defer conn.Close()
+
+	ReportSystemdUnits(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_systemd_unit_state|sshd.service|service|active", 1)
+	helper.VerifyMetric(t, mc, "metricly_systemd_unit_state|sshd.service|service|failed", 0)
+	helper.VerifyMetric(t, mc, "metricly_systemd_unit_state|crond.service|service|failed", 1)
+	helper.VerifyMetric(t, mc, "metricly_systemd_unit_sub_state|logrotate.timer|timer|waiting", 1)
+	helper.VerifyMetric(t, mc, "metricly_systemd_service_restarts_total|crond.service", 5)
+	helper.VerifyMetric(t, mc, "metricly_systemd_units|active", 2)
+	helper.VerifyMetric(t, mc, "metricly_systemd_units|failed", 1)
+
+	for _, unit := range []string{"user@1000.service|service", "home.mount|mount"} {
+		if _, exists := mc.Data["metricly_systemd_unit_state|"+unit+"|active"]; exists {
+			t.Errorf("expected %s to be filtered out", unit)
+		}
+	}
+	if _, exists := mc.Data["metricly_systemd_service_restarts_total|logrotate.timer"]; exists {
+		t.Errorf("expected restarts to be reported for services only")
+	}
+	// services whose restarts can't be read are left out instead of 0
+	delete(fakeRestarts, "/org/freedesktop/systemd1/unit/crond_2eservice")
+	defer func() { fakeRestarts["/org/freedesktop/systemd1/unit/crond_2eservice"] = 5 }()
+	ReportSystemdUnits(context.Background(), mc)
+	if _, exists := mc.Data["metricly_systemd_service_restarts_total|crond.service"]; exists {
+		t.Errorf("expected unknown restarts not to be reported")
+	}
+	helper.VerifyMetric(t, mc, "metricly_systemd_service_restarts_total|sshd.service", 0)
+}
+
+func TestRegisterSystemdMetricsDisabled(t *testing.T) {
+	mc := collector.CreateMetricCollector()
+
+	if RegisterSystemdMetrics(mc, config.SystemdConfig{Enabled: false}) {
+		t.Errorf("expected systemd collector to be disabled by default")
+	}
+	if RegisterSystemdMetrics(mc, config.SystemdConfig{Enabled: true, UnitInclude: "(invalid"}) {
+		t.Errorf("expected invalid regex to disable systemd collector")
+	}
+
+	// nothing listens on the socket
+	t.Setenv("SYSTEMD_DBUS_SOCKET", filepath.Join(t.TempDir(), "missing_socket"))
+	if RegisterSystemdMetrics(mc, config.SystemdConfig{Enabled: true}) {
+		t.Errorf("expected unreachable bus to disable systemd collector")
+	}
+	if _, exists := mc.Metrics["metricly_systemd_unit_state"]; exists {
+		t.Errorf("expected no metric to be registered when disabled")
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	collector "metricly/internal/collector"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func SetupCollectorSources(fileName, fileContent string) error {
@@ -22,6 +26,22 @@ func SetupCollectorSources(fileName, fileContent string) error {
 	return nil
 }
 
+// SetupSysfsTree creates a temporary directory tree mimicking sysfs, where
+// files maps paths relative to the returned root to their content
+func SetupSysfsTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create sysfs dir: %v", err)
+		}
+		if err := SetupCollectorSources(path, content); err != nil {
+			t.Fatalf("failed to setup collector file: %v", err)
+		}
+	}
+	return root
+}
+
 func VerifyMetric(t *testing.T, mc *collector.MetriclyCollector, metricName string, metricValue float64) {
 
 	// Validate metrics
@@ -33,3 +53,65 @@ func VerifyMetric(t *testing.T, mc *collector.MetriclyCollector, metricName stri
 		t.Fatalf("%s not found in metrics data", metricName)
 	}
 }
+
+// GatherMetrics runs mc through a registry the same way a scrape does
+func GatherMetrics(t *testing.T, mc *collector.MetriclyCollector) map[string]*dto.MetricFamily {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(mc); err != nil {
+		t.Fatalf("failed to register collector: %v", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	result := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		result[family.GetName()] = family
+	}
+	return result
+}
+
+// FindGatheredMetric returns the series of a gathered family carrying all of labels
+func FindGatheredMetric(families map[string]*dto.MetricFamily, metricName string, labels map[string]string) *dto.Metric {
+	family, exists := families[metricName]
+	if !exists {
+		return nil
+	}
+	for _, metric := range family.Metric {
+		matched := 0
+		for _, label := range metric.Label {
+			if value, exists := labels[label.GetName()]; exists && value == label.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return metric
+		}
+	}
+	return nil
+}
+
+// VerifyGatheredMetric validates series which are not kept in mc.Data, like
+// the ones added through SetMetrics
+func VerifyGatheredMetric(t *testing.T, mc *collector.MetriclyCollector, metricName string, labels map[string]string, metricValue float64) {
+	metric := FindGatheredMetric(GatherMetrics(t, mc), metricName, labels)
+	if metric == nil {
+		t.Fatalf("%s%v not found in gathered metrics", metricName, labels)
+	}
+
+	var value float64
+	switch {
+	case metric.Counter != nil:
+		value = metric.Counter.GetValue()
+	case metric.Gauge != nil:
+		value = metric.Gauge.GetValue()
+	case metric.Untyped != nil:
+		value = metric.Untyped.GetValue()
+	default:
+		t.Fatalf("%s%v is not a counter, gauge or untyped metric", metricName, labels)
+	}
+	if value != metricValue {
+		t.Fatalf("expected %s%v=%f, got %f", metricName, labels, metricValue, value)
+	}
+}
@@ -0,0 +1,246 @@
+package textfile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	textfileDirectory string
+)
+
+// ParseFamilies parses the Prometheus text exposition format
+func ParseFamilies(r io.Reader) (map[string]*dto.MetricFamily, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, family := range families {
+		for _, metric := range family.Metric {
+			if metric.TimestampMs != nil {
+				return nil, fmt.Errorf("metric %s has a timestamp, which isn't supported", name)
+			}
+		}
+	}
+	return families, nil
+}
+
+// MergeFamilies adds the series of src into dst. Families with a conflicting
+// type and series already present in dst are rejected.
+func MergeFamilies(dst, src map[string]*dto.MetricFamily) error {
+	// validate everything first so dst is left untouched on error
+	for name, family := range src {
+		existing, exists := dst[name]
+		if !exists {
+			continue
+		}
+		if existing.GetType() != family.GetType() {
+			return fmt.Errorf("metric %s reported as %s and %s", name, existing.GetType(), family.GetType())
+		}
+
+		seen := make(map[string]bool)
+		for _, metric := range existing.Metric {
+			seen[labelSignature(metric)] = true
+		}
+		for _, metric := range family.Metric {
+			if seen[labelSignature(metric)] {
+				return fmt.Errorf("metric %s%s reported more than once", name, labelSignature(metric))
+			}
+		}
+	}
+
+	for name, family := range src {
+		if existing, exists := dst[name]; exists {
+			existing.Metric = append(existing.Metric, family.Metric...)
+		} else {
+			dst[name] = family
+		}
+	}
+	return nil
+}
+
+// labelSignature renders labels as {a="1",b="2"} to detect duplicate series
+func labelSignature(metric *dto.Metric) string {
+	pairs := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// ConvertFamilies builds const metrics out of parsed families. The hostname
+// label, as well as extraLabels, are attached to every series unless the
+// series already carries them.
+func ConvertFamilies(families map[string]*dto.MetricFamily, extraLabels map[string]string) ([]prometheus.Metric, error) {
+	var metrics []prometheus.Metric
+
+	for name, family := range families {
+		for _, metric := range family.Metric {
+			var labelNames, labelValues []string
+			constLabels := prometheus.Labels{"hostname": common.GetHostname()}
+			for key, value := range extraLabels {
+				constLabels[key] = value
+			}
+			for _, label := range metric.Label {
+				labelNames = append(labelNames, label.GetName())
+				labelValues = append(labelValues, label.GetValue())
+				delete(constLabels, label.GetName())
+			}
+
+			desc := prometheus.NewDesc(name, family.GetHelp(), labelNames, constLabels)
+
+			var (
+				constMetric prometheus.Metric
+				err         error
+			)
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				constMetric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, metric.Counter.GetValue(), labelValues...)
+			case dto.MetricType_GAUGE:
+				constMetric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, metric.Gauge.GetValue(), labelValues...)
+			case dto.MetricType_UNTYPED:
+				constMetric, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, metric.Untyped.GetValue(), labelValues...)
+			case dto.MetricType_HISTOGRAM:
+				buckets := make(map[float64]uint64)
+				for _, bucket := range metric.Histogram.Bucket {
+					buckets[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+				}
+				constMetric, err = prometheus.NewConstHistogram(
+					desc,
+					metric.Histogram.GetSampleCount(),
+					metric.Histogram.GetSampleSum(),
+					buckets,
+					labelValues...,
+				)
+			case dto.MetricType_SUMMARY:
+				quantiles := make(map[float64]float64)
+				for _, quantile := range metric.Summary.Quantile {
+					quantiles[quantile.GetQuantile()] = quantile.GetValue()
+				}
+				constMetric, err = prometheus.NewConstSummary(
+					desc,
+					metric.Summary.GetSampleCount(),
+					metric.Summary.GetSampleSum(),
+					quantiles,
+					labelValues...,
+				)
+			default:
+				err = fmt.Errorf("unsupported metric type %s", family.GetType())
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric %s: %v", name, err)
+			}
+			metrics = append(metrics, constMetric)
+		}
+	}
+	return metrics, nil
+}
+
+// parseTextfile reads a single *.prom file
+func parseTextfile(path string) (map[string]*dto.MetricFamily, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	families, err := ParseFamilies(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return families, nil
+}
+
+// RegisterTextfileMetrics registers textfile metrics and sets the directory
+// scanned for *.prom files.
+func RegisterTextfileMetrics(mc *collector.MetriclyCollector, directory string) {
+	textfileDirectory = directory
+
+	mc.AddMetric("textfile_scrape_error", "1 if there was an error opening or reading a file, 0 otherwise", []string{})
+	mc.AddMetric("textfile_mtime_seconds", "Unixtime mtime of textfiles successfully read", []string{"file"})
+}
+
+// ReportTextfileMetrics merges metrics of every *.prom file into the registry.
+func ReportTextfileMetrics(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	if _, err := os.Stat(textfileDirectory); err != nil {
+		mc.UpdateMetric("textfile_scrape_error", 1, []string{})
+		return fmt.Errorf("failed to open textfile directory: %v", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(textfileDirectory, "*.prom"))
+	if err != nil {
+		mc.UpdateMetric("textfile_scrape_error", 1, []string{})
+		return fmt.Errorf("failed to list textfiles in %s: %v", textfileDirectory, err)
+	}
+
+	scrapeError := 0.0
+	families := make(map[string]*dto.MetricFamily)
+	mtimes := make(map[string]float64)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("failed to stat %s: %v", path, err))
+			scrapeError = 1
+			continue
+		}
+
+		fileFamilies, err := parseTextfile(path)
+		for name := range fileFamilies {
+			if strings.HasPrefix(name, "metricly_") {
+				err = fmt.Errorf("metric %s clashes with metricly's own metrics", name)
+				break
+			}
+		}
+		if err == nil {
+			err = MergeFamilies(families, fileFamilies)
+		}
+		if err != nil {
+			// a broken file is skipped as a whole so partial results are never exported
+			slog.Warn(fmt.Sprintf("skipping textfile %s: %v", path, err))
+			scrapeError = 1
+			continue
+		}
+		mtimes[filepath.Base(path)] = float64(info.ModTime().UnixNano()) / 1e9
+	}
+
+	metrics, err := ConvertFamilies(families, nil)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("failed to convert textfile metrics: %v", err))
+		scrapeError = 1
+		metrics = nil
+	}
+	if err := mc.SetMetrics("textfile", metrics); err != nil {
+		slog.Warn(fmt.Sprintf("skipping textfiles: %v", err))
+		scrapeError = 1
+	}
+
+	series := make([]collector.Series, 0, len(mtimes))
+	for file, mtime := range mtimes {
+		series = append(series, collector.Series{Value: mtime, Labels: []string{file}})
+	}
+	// removed files must not be reported anymore
+	mc.ReplaceMetric("textfile_mtime_seconds", series)
+	mc.UpdateMetric("textfile_scrape_error", scrapeError, []string{})
+
+	// broken files are reported by textfile_scrape_error
+	slog.Info(fmt.Sprintf("Collected Textfile metrics in %s", time.Since(start)))
+	return nil
+}
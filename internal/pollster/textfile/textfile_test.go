@@ -0,0 +1,126 @@
+package textfile
+
+import (
+	"context"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var backupTextfile = `# HELP backup_last_success_timestamp_seconds Last successful backup.
+# TYPE backup_last_success_timestamp_seconds gauge
+backup_last_success_timestamp_seconds{job="postgres"} 1729324800
+# HELP backup_bytes_total Bytes backed up.
+# TYPE backup_bytes_total counter
+backup_bytes_total{job="postgres"} 5.36870912e+09
+`
+
+var patchingTextfile = `# TYPE patching_duration_seconds histogram
+patching_duration_seconds_bucket{le="60"} 2
+patching_duration_seconds_bucket{le="300"} 5
+patching_duration_seconds_bucket{le="+Inf"} 6
+patching_duration_seconds_sum 1210
+patching_duration_seconds_count 6
+# TYPE backup_last_success_timestamp_seconds gauge
+backup_last_success_timestamp_seconds{job="etcd"} 1729328400
+`
+
+func TestParseAndMergeFamilies(t *testing.T) {
+	families, err := ParseFamilies(strings.NewReader(backupTextfile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(families) != 2 {
+		t.Fatalf("expected 2 families, got %d", len(families))
+	}
+
+	other, err := ParseFamilies(strings.NewReader(patchingTextfile))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := MergeFamilies(families, other); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	if len(families["backup_last_success_timestamp_seconds"].Metric) != 2 {
+		t.Errorf("expected series of both files to be merged")
+	}
+
+	// the same series reported twice must be rejected without touching dst
+	duplicate, _ := ParseFamilies(strings.NewReader(`backup_bytes_total{job="postgres"} 1
+new_metric 1
+`))
+	if err := MergeFamilies(families, duplicate); err == nil {
+		t.Errorf("expected duplicate series to be rejected")
+	}
+	if _, exists := families["new_metric"]; exists {
+		t.Errorf("rejected families must not be merged")
+	}
+
+	if _, err := ParseFamilies(strings.NewReader("metric_with_timestamp 1 1729324800000\n")); err == nil {
+		t.Errorf("expected timestamps to be rejected")
+	}
+}
+
+func TestReportTextfileMetrics(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+
+	dir := helper.SetupSysfsTree(t, map[string]string{
+		"backup.prom":   backupTextfile,
+		"patching.prom": patchingTextfile,
+		"broken.prom":   "this is { not valid\n",
+		"ignored.txt":   "not_a_textfile 1\n",
+	})
+
+	mc := collector.CreateMetricCollector()
+	RegisterTextfileMetrics(mc, dir)
+
+	ReportTextfileMetrics(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_textfile_scrape_error", 1)
+	if _, exists := mc.Data["metricly_textfile_mtime_seconds|backup.prom"]; !exists {
+		t.Errorf("expected mtime of backup.prom to be reported")
+	}
+	if _, exists := mc.Data["metricly_textfile_mtime_seconds|broken.prom"]; exists {
+		t.Errorf("expected no mtime for broken.prom")
+	}
+
+	helper.VerifyGatheredMetric(t, mc, "backup_bytes_total", map[string]string{"job": "postgres", "hostname": "testhost"}, 5368709120)
+	helper.VerifyGatheredMetric(t, mc, "backup_last_success_timestamp_seconds", map[string]string{"job": "etcd"}, 1729328400)
+
+	families := helper.GatherMetrics(t, mc)
+	histogram := helper.FindGatheredMetric(families, "patching_duration_seconds", map[string]string{})
+	if histogram == nil || histogram.Histogram.GetSampleCount() != 6 {
+		t.Fatalf("expected patching_duration_seconds histogram with 6 samples, got %v", histogram)
+	}
+
+	// fixing and removing files is picked up on the next collection
+	if err := os.Remove(filepath.Join(dir, "broken.prom")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "patching.prom")); err != nil {
+		t.Fatal(err)
+	}
+	ReportTextfileMetrics(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_textfile_scrape_error", 0)
+	if _, exists := mc.Data["metricly_textfile_mtime_seconds|patching.prom"]; exists {
+		t.Errorf("expected mtime of removed file to be dropped")
+	}
+	families = helper.GatherMetrics(t, mc)
+	if _, exists := families["patching_duration_seconds"]; exists {
+		t.Errorf("expected metrics of removed file to be dropped")
+	}
+
+	// a metric already reported by another source is refused instead of
+	// failing the whole scrape
+	scriptFamilies, _ := ParseFamilies(strings.NewReader("backup_bytes_total{job=\"postgres\"} 1\n"))
+	scriptMetrics, _ := ConvertFamilies(scriptFamilies, nil)
+	if err := mc.SetMetrics("script_backup", scriptMetrics); err == nil {
+		t.Errorf("expected metric reported by textfile to be refused")
+	}
+	helper.GatherMetrics(t, mc)
+	helper.VerifyGatheredMetric(t, mc, "backup_bytes_total", map[string]string{"job": "postgres"}, 5368709120)
+}
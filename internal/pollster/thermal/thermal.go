@@ -0,0 +1,218 @@
+package thermal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"metricly/pkg/common"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	sysClassThermal = "/sys/class/thermal"
+	sysClassHwmon   = "/sys/class/hwmon"
+)
+
+// thermalZoneStats holds readings of a single /sys/class/thermal/thermal_zone*
+type thermalZoneStats struct {
+	Zone        string
+	Type        string
+	Temperature float64 // Celsius
+	Critical    float64 // Celsius, 0 if the zone has no critical trip point
+}
+
+// hwmonSensor holds a single reading of a hwmon chip
+type hwmonSensor struct {
+	Device string // hwmon0, hwmon1...
+	Chip   string // content of the name file, e.g. coretemp
+	Sensor string // content of the label file, falls back to the file prefix e.g. temp1
+	Value  float64
+}
+
+type hwmonStats struct {
+	Temperatures []hwmonSensor // Celsius
+	Critical     []hwmonSensor // Celsius
+	Fans         []hwmonSensor // RPM
+	Voltages     []hwmonSensor // Volts
+}
+
+// readMilliValue reads sysfs files reporting millidegree or millivolt values
+func readMilliValue(path string) (float64, error) {
+	value, err := common.ReadSysfsValue(path)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value in %s: %v", path, err)
+	}
+	return parsed / 1000, nil
+}
+
+// readThermalZones reads temperatures and critical trip points from /sys/class/thermal
+func readThermalZones() ([]thermalZoneStats, error) {
+
+	if sysClassThermalEnv := os.Getenv("SYS_CLASS_THERMAL"); sysClassThermalEnv != "" {
+		sysClassThermal = sysClassThermalEnv
+	}
+
+	zones, err := filepath.Glob(filepath.Join(sysClassThermal, "thermal_zone*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list thermal zones in %s: %v", sysClassThermal, err)
+	}
+
+	var stats []thermalZoneStats
+	for _, zonePath := range zones {
+		temp, err := readMilliValue(filepath.Join(zonePath, "temp"))
+		if err != nil {
+			// disabled zones return EINVAL or ENODATA on read
+			slog.Debug(fmt.Sprintf("skipping thermal zone %s: %v", zonePath, err))
+			continue
+		}
+
+		zoneType, _ := common.ReadSysfsValue(filepath.Join(zonePath, "type"))
+		zone := thermalZoneStats{
+			Zone:        filepath.Base(zonePath),
+			Type:        zoneType,
+			Temperature: temp,
+		}
+
+		// trip points are numbered, look for the one marked critical
+		tripTypes, _ := filepath.Glob(filepath.Join(zonePath, "trip_point_*_type"))
+		for _, tripType := range tripTypes {
+			if value, _ := common.ReadSysfsValue(tripType); value != "critical" {
+				continue
+			}
+			tripTemp := strings.TrimSuffix(tripType, "_type") + "_temp"
+			if critical, err := readMilliValue(tripTemp); err == nil {
+				zone.Critical = critical
+			}
+			break
+		}
+
+		stats = append(stats, zone)
+	}
+
+	return stats, nil
+}
+
+// readHwmonSensors reads temperature, fan and voltage inputs from /sys/class/hwmon
+func readHwmonSensors() (hwmonStats, error) {
+
+	if sysClassHwmonEnv := os.Getenv("SYS_CLASS_HWMON"); sysClassHwmonEnv != "" {
+		sysClassHwmon = sysClassHwmonEnv
+	}
+
+	devices, err := filepath.Glob(filepath.Join(sysClassHwmon, "hwmon*"))
+	if err != nil {
+		return hwmonStats{}, fmt.Errorf("failed to list hwmon devices in %s: %v", sysClassHwmon, err)
+	}
+
+	var stats hwmonStats
+	for _, devicePath := range devices {
+		device := filepath.Base(devicePath)
+		chip, err := common.ReadSysfsValue(filepath.Join(devicePath, "name"))
+		if err != nil {
+			chip = device
+		}
+
+		inputs, _ := filepath.Glob(filepath.Join(devicePath, "*_input"))
+		for _, input := range inputs {
+			// temp1_input -> temp1
+			prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+			sensor, err := common.ReadSysfsValue(filepath.Join(devicePath, prefix+"_label"))
+			if err != nil || sensor == "" {
+				sensor = prefix
+			}
+			reading := hwmonSensor{Device: device, Chip: chip, Sensor: sensor}
+
+			switch {
+			case strings.HasPrefix(prefix, "temp"):
+				if reading.Value, err = readMilliValue(input); err != nil {
+					continue
+				}
+				stats.Temperatures = append(stats.Temperatures, reading)
+
+				if critical, err := readMilliValue(filepath.Join(devicePath, prefix+"_crit")); err == nil {
+					reading.Value = critical
+					stats.Critical = append(stats.Critical, reading)
+				}
+			case strings.HasPrefix(prefix, "fan"):
+				value, err := common.ReadSysfsValue(input)
+				if err != nil {
+					continue
+				}
+				reading.Value = float64(common.ParseUint(value))
+				stats.Fans = append(stats.Fans, reading)
+			case strings.HasPrefix(prefix, "in"):
+				// voltages are reported in millivolts
+				if reading.Value, err = readMilliValue(input); err != nil {
+					continue
+				}
+				stats.Voltages = append(stats.Voltages, reading)
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// RegisterThermalMetrics registers thermal zone and hwmon metrics.
+func RegisterThermalMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("thermal_zone_temperature_celsius", "Thermal zone temperature in celsius", []string{"zone", "type"})
+	mc.AddMetric("thermal_zone_critical_celsius", "Thermal zone critical trip point in celsius", []string{"zone", "type"})
+	mc.AddMetric("hwmon_temperature_celsius", "Hardware monitor temperature in celsius", []string{"device", "chip", "sensor"})
+	mc.AddMetric("hwmon_temperature_critical_celsius", "Hardware monitor critical temperature in celsius", []string{"device", "chip", "sensor"})
+	mc.AddMetric("hwmon_fan_rpm", "Hardware monitor fan speed in RPM", []string{"device", "chip", "sensor"})
+	mc.AddMetric("hwmon_voltage_volts", "Hardware monitor voltage in volts", []string{"device", "chip", "sensor"})
+}
+
+// ReportThermalStats reports thermal zone and hwmon readings.
+func ReportThermalStats(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	// hwmon sensors are still reported if thermal zones can't be listed
+	zones, zonesErr := readThermalZones()
+	for _, zone := range zones {
+		mc.UpdateMetric(
+			"thermal_zone_temperature_celsius",
+			zone.Temperature,
+			[]string{zone.Zone, zone.Type},
+		)
+		if zone.Critical != 0 {
+			mc.UpdateMetric(
+				"thermal_zone_critical_celsius",
+				zone.Critical,
+				[]string{zone.Zone, zone.Type},
+			)
+		}
+	}
+
+	sensors, err := readHwmonSensors()
+	if err != nil {
+		return errors.Join(zonesErr, err)
+	}
+
+	reportSensors := func(name string, readings []hwmonSensor) {
+		for _, reading := range readings {
+			mc.UpdateMetric(
+				name,
+				reading.Value,
+				[]string{reading.Device, reading.Chip, reading.Sensor},
+			)
+		}
+	}
+	reportSensors("hwmon_temperature_celsius", sensors.Temperatures)
+	reportSensors("hwmon_temperature_critical_celsius", sensors.Critical)
+	reportSensors("hwmon_fan_rpm", sensors.Fans)
+	reportSensors("hwmon_voltage_volts", sensors.Voltages)
+
+	slog.Info(fmt.Sprintf("Collected Thermal metrics in %s", time.Since(start)))
+	return zonesErr
+}
@@ -0,0 +1,78 @@
+package thermal
+
+import (
+	"context"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"testing"
+)
+
+func TestReadThermalZones(t *testing.T) {
+	root := helper.SetupSysfsTree(t, map[string]string{
+		"thermal_zone0/type":              "x86_pkg_temp\n",
+		"thermal_zone0/temp":              "45000\n",
+		"thermal_zone0/trip_point_0_type": "passive\n",
+		"thermal_zone0/trip_point_0_temp": "95000\n",
+		"thermal_zone0/trip_point_1_type": "critical\n",
+		"thermal_zone0/trip_point_1_temp": "105000\n",
+		"thermal_zone1/type":              "acpitz\n",
+		"thermal_zone1/temp":              "27800\n",
+	})
+	tmpSrc := sysClassThermal
+	defer func() { sysClassThermal = tmpSrc }()
+	sysClassThermal = root
+
+	zones, err := readThermalZones()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(zones) != 2 {
+		t.Fatalf("expected 2 thermal zones, got %d", len(zones))
+	}
+	if zones[0].Type != "x86_pkg_temp" || zones[0].Temperature != 45 {
+		t.Errorf("unexpected thermal_zone0 reading: %+v", zones[0])
+	}
+	if zones[0].Critical != 105 {
+		t.Errorf("expected critical=105, got %f", zones[0].Critical)
+	}
+	if zones[1].Temperature != 27.8 || zones[1].Critical != 0 {
+		t.Errorf("unexpected thermal_zone1 reading: %+v", zones[1])
+	}
+}
+
+func TestReportThermalStats(t *testing.T) {
+	thermalRoot := helper.SetupSysfsTree(t, map[string]string{
+		"thermal_zone0/type": "acpitz\n",
+		"thermal_zone0/temp": "50000\n",
+	})
+	hwmonRoot := helper.SetupSysfsTree(t, map[string]string{
+		"hwmon0/name":        "coretemp\n",
+		"hwmon0/temp1_input": "61000\n",
+		"hwmon0/temp1_label": "Package id 0\n",
+		"hwmon0/temp1_crit":  "100000\n",
+		"hwmon0/temp2_input": "58000\n",
+		"hwmon1/name":        "nct6775\n",
+		"hwmon1/fan1_input":  "1200\n",
+		"hwmon1/in0_input":   "1104\n",
+		"hwmon1/in0_label":   "Vcore\n",
+	})
+	tmpThermal, tmpHwmon := sysClassThermal, sysClassHwmon
+	defer func() {
+		sysClassThermal = tmpThermal
+		sysClassHwmon = tmpHwmon
+	}()
+	sysClassThermal = thermalRoot
+	sysClassHwmon = hwmonRoot
+
+	mc := collector.CreateMetricCollector()
+	RegisterThermalMetrics(mc)
+
+	ReportThermalStats(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_thermal_zone_temperature_celsius|thermal_zone0|acpitz", 50)
+	helper.VerifyMetric(t, mc, "metricly_hwmon_temperature_celsius|hwmon0|coretemp|Package id 0", 61)
+	helper.VerifyMetric(t, mc, "metricly_hwmon_temperature_celsius|hwmon0|coretemp|temp2", 58)
+	helper.VerifyMetric(t, mc, "metricly_hwmon_temperature_critical_celsius|hwmon0|coretemp|Package id 0", 100)
+	helper.VerifyMetric(t, mc, "metricly_hwmon_fan_rpm|hwmon1|nct6775|fan1", 1200)
+	helper.VerifyMetric(t, mc, "metricly_hwmon_voltage_volts|hwmon1|nct6775|Vcore", 1.104)
+}
@@ -0,0 +1,113 @@
+//go:build linux
+
+package timex
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	collector "metricly/internal/collector"
+	"syscall"
+	"time"
+)
+
+const (
+	// status bits and clock states from linux/timex.h
+	staUnsync = 0x0040
+	staNano   = 0x2000
+	timeError = 5
+
+	// adjtimex reports frequencies in ppm with a 16 bit fractional part
+	ppm65536 = 65536 * 1e6
+)
+
+var (
+	// replaced in tests, Modes = 0 makes adjtimex read-only so no
+	// privileges are needed and the clock is never modified
+	adjtimex = syscall.Adjtimex
+)
+
+// timexStats holds the kernel clock discipline state converted to SI units
+type timexStats struct {
+	Offset         float64 // seconds
+	Frequency      float64 // ratio
+	MaxError       float64 // seconds
+	EstimatedError float64 // seconds
+	Status         int32
+	Synchronized   bool
+	TimeConstant   int64
+	Tick           float64 // seconds
+	TAIOffset      int32   // seconds
+	Time           float64 // unix timestamp
+}
+
+// readTimexStats reads the kernel NTP state through adjtimex(2)
+func readTimexStats() (timexStats, error) {
+	var tx syscall.Timex
+
+	state, err := adjtimex(&tx)
+	if err != nil {
+		return timexStats{}, fmt.Errorf("failed to call adjtimex: %v", err)
+	}
+
+	// offset is in microseconds unless the clock runs in nanosecond mode
+	divisor := 1e6
+	if tx.Status&staNano != 0 {
+		divisor = 1e9
+	}
+
+	return timexStats{
+		Offset:         float64(tx.Offset) / divisor,
+		Frequency:      float64(tx.Freq) / ppm65536,
+		MaxError:       float64(tx.Maxerror) / 1e6,
+		EstimatedError: float64(tx.Esterror) / 1e6,
+		Status:         tx.Status,
+		Synchronized:   tx.Status&staUnsync == 0 && state != timeError,
+		TimeConstant:   int64(tx.Constant),
+		Tick:           float64(tx.Tick) / 1e6,
+		TAIOffset:      tx.Tai,
+		Time:           float64(tx.Time.Sec) + float64(tx.Time.Usec)/divisor,
+	}, nil
+}
+
+func RegisterTimexMetrics(mc *collector.MetriclyCollector) {
+	mc.AddMetric("time_seconds", "System time as unix timestamp", []string{})
+	mc.AddMetric("timex_offset_seconds", "Time offset between local system and reference clock", []string{})
+	mc.AddMetric("timex_frequency_adjustment_ratio", "Local clock frequency adjustment", []string{})
+	mc.AddMetric("timex_maxerror_seconds", "Maximum error in seconds", []string{})
+	mc.AddMetric("timex_estimated_error_seconds", "Estimated error in seconds", []string{})
+	mc.AddMetric("timex_sync_status", "Is clock synchronized to a reliable server (1 = yes, 0 = no)", []string{})
+	mc.AddMetric("timex_status", "Value of the clock status bits", []string{})
+	mc.AddMetric("timex_loop_time_constant", "Phase-locked loop time constant", []string{})
+	mc.AddMetric("timex_tick_seconds", "Seconds between clock ticks", []string{})
+	mc.AddMetric("timex_tai_offset_seconds", "International Atomic Time (TAI) offset", []string{})
+}
+
+// ReportTimexStats reports clock synchronization state.
+func ReportTimexStats(ctx context.Context, mc *collector.MetriclyCollector) error {
+	start := time.Now()
+
+	stats, err := readTimexStats()
+	if err != nil {
+		return err
+	}
+
+	syncStatus := 0.0
+	if stats.Synchronized {
+		syncStatus = 1
+	}
+
+	mc.UpdateMetric("time_seconds", stats.Time, []string{})
+	mc.UpdateMetric("timex_offset_seconds", stats.Offset, []string{})
+	mc.UpdateMetric("timex_frequency_adjustment_ratio", stats.Frequency, []string{})
+	mc.UpdateMetric("timex_maxerror_seconds", stats.MaxError, []string{})
+	mc.UpdateMetric("timex_estimated_error_seconds", stats.EstimatedError, []string{})
+	mc.UpdateMetric("timex_sync_status", syncStatus, []string{})
+	mc.UpdateMetric("timex_status", float64(stats.Status), []string{})
+	mc.UpdateMetric("timex_loop_time_constant", float64(stats.TimeConstant), []string{})
+	mc.UpdateMetric("timex_tick_seconds", stats.Tick, []string{})
+	mc.UpdateMetric("timex_tai_offset_seconds", float64(stats.TAIOffset), []string{})
+
+	slog.Info(fmt.Sprintf("Collected Timex metrics in %s", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package timex
+
+import (
+	"context"
+	"log/slog"
+	collector "metricly/internal/collector"
+)
+
+// RegisterTimexMetrics registers nothing, adjtimex(2) is Linux only
+func RegisterTimexMetrics(mc *collector.MetriclyCollector) {
+	slog.Warn("Timex metrics are only supported on Linux")
+}
+
+// ReportTimexStats reports nothing outside of Linux.
+func ReportTimexStats(ctx context.Context, mc *collector.MetriclyCollector) error { return nil }
@@ -0,0 +1,84 @@
+//go:build linux
+
+package timex
+
+import (
+	"context"
+	"errors"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+	"syscall"
+	"testing"
+)
+
+func mockAdjtimex(status int32, state int) func(*syscall.Timex) (int, error) {
+	return func(tx *syscall.Timex) (int, error) {
+		tx.Offset = -2500
+		tx.Freq = 655360 // 10ppm
+		tx.Maxerror = 16000
+		tx.Esterror = 500
+		tx.Status = status
+		tx.Constant = 7
+		tx.Tick = 10000
+		tx.Tai = 37
+		tx.Time = syscall.Timeval{Sec: 1729324800, Usec: 500000}
+		return state, nil
+	}
+}
+
+func TestReadTimexStats(t *testing.T) {
+	tmpAdjtimex := adjtimex
+	defer func() { adjtimex = tmpAdjtimex }()
+
+	adjtimex = mockAdjtimex(0x2001, 0) // STA_PLL | STA_NANO, TIME_OK
+	stats, err := readTimexStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Offset != -0.0000025 {
+		t.Errorf("expected Offset=-0.0000025 in nanosecond mode, got %g", stats.Offset)
+	}
+	if stats.Frequency != 0.00001 {
+		t.Errorf("expected Frequency=0.00001, got %g", stats.Frequency)
+	}
+	if stats.MaxError != 0.016 || stats.EstimatedError != 0.0005 {
+		t.Errorf("unexpected errors: max=%g est=%g", stats.MaxError, stats.EstimatedError)
+	}
+	if !stats.Synchronized {
+		t.Errorf("expected clock to be synchronized")
+	}
+
+	adjtimex = mockAdjtimex(0x0041, 5) // STA_PLL | STA_UNSYNC, TIME_ERROR
+	stats, err = readTimexStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Offset != -0.0025 {
+		t.Errorf("expected Offset=-0.0025 in microsecond mode, got %g", stats.Offset)
+	}
+	if stats.Synchronized {
+		t.Errorf("expected clock to be unsynchronized")
+	}
+
+	adjtimex = func(*syscall.Timex) (int, error) { return -1, errors.New("operation not permitted") }
+	if _, err := readTimexStats(); err == nil {
+		t.Errorf("expected adjtimex error to be returned")
+	}
+}
+
+func TestReportTimexStats(t *testing.T) {
+	tmpAdjtimex := adjtimex
+	defer func() { adjtimex = tmpAdjtimex }()
+	adjtimex = mockAdjtimex(0x0001, 0)
+
+	mc := collector.CreateMetricCollector()
+	RegisterTimexMetrics(mc)
+
+	ReportTimexStats(context.Background(), mc)
+
+	helper.VerifyMetric(t, mc, "metricly_timex_sync_status", 1)
+	helper.VerifyMetric(t, mc, "metricly_timex_offset_seconds", -0.0025)
+	helper.VerifyMetric(t, mc, "metricly_timex_tai_offset_seconds", 37)
+	helper.VerifyMetric(t, mc, "metricly_timex_tick_seconds", 0.01)
+	helper.VerifyMetric(t, mc, "metricly_time_seconds", 1729324800.5)
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"metricly/config"
+	"metricly/pkg/prometheus"
+)
+
+// a pollster which hasn't completed a collection for this many intervals is
+// considered stuck
+const stuckIntervals = 3
+
+// the result of the Prometheus readiness check is reused this long, so
+// frequent probes don't each wait up to its timeout
+var prometheusCheckInterval = 10 * time.Second
+
+// pollsterState tracks collections of a pollster
+type pollsterState struct {
+	Interval time.Duration
+	// registration time until the first collection completes
+	LastCompleted time.Time
+	Collections   int
+	// successful collections, and the error of the last failed one
+	Successes int
+	LastError string
+}
+
+// healthTracker records the progress of pollsters for health endpoints
+type healthTracker struct {
+	mutex     sync.Mutex
+	pollsters map[string]*pollsterState
+	// set when a reload stopped the pollsters but collections didn't return
+	stopError string
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{pollsters: make(map[string]*pollsterState)}
+}
+
+// register starts tracking a pollster collecting every interval
+func (h *healthTracker) register(name string, interval time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.pollsters[name] = &pollsterState{Interval: interval, LastCompleted: time.Now()}
+}
+
+// completed records a collection of a pollster, which failed if err is set
+func (h *healthTracker) completed(name string, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	state, exists := h.pollsters[name]
+	if !exists {
+		return
+	}
+	state.LastCompleted = time.Now()
+	state.Collections++
+	if err != nil {
+		state.LastError = err.Error()
+		return
+	}
+	state.Successes++
+	state.LastError = ""
+}
+
+// stopFailed records that collections didn't return when the pollsters were
+// stopped by a reload, so the pollsters no longer collect
+func (h *healthTracker) stopFailed(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.stopError = err.Error()
+}
+
+// collected reports whether every pollster completed a collection, even a
+// failed one
+func (h *healthTracker) collected() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, state := range h.pollsters {
+		if state.Collections == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// stuck returns the pollsters which didn't complete a collection for
+// stuckIntervals, e.g. blocked reading a hung NFS mount, and whether a reload
+// failed to stop them. Failed collections count, a pollster retrying a
+// missing device isn't restarted.
+func (h *healthTracker) stuck() map[string]string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	failures := make(map[string]string)
+	if h.stopError != "" {
+		failures["pollsters"] = "stopped by a reload: " + h.stopError
+	}
+	for name, state := range h.pollsters {
+		if since := time.Since(state.LastCompleted); since > stuckIntervals*state.Interval {
+			failures["pollster/"+name] = fmt.Sprintf("no collection completed for %s", since.Round(time.Second))
+		}
+	}
+	return failures
+}
+
+// pending returns the pollsters which haven't completed a successful
+// collection yet
+func (h *healthTracker) pending() map[string]string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	failures := make(map[string]string)
+	for name, state := range h.pollsters {
+		switch {
+		case state.Successes > 0:
+		case state.LastError != "":
+			failures["pollster/"+name] = "no collection succeeded: " + state.LastError
+		default:
+			failures["pollster/"+name] = "first collection not completed"
+		}
+	}
+	return failures
+}
+
+// cachedCheck reuses the result of a check for prometheusCheckInterval
+type cachedCheck struct {
+	mutex   sync.Mutex
+	check   func() error
+	checked time.Time
+	err     error
+}
+
+// result runs the check if its last result expired, concurrent callers
+// wait for the same check
+func (c *cachedCheck) result() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.checked.IsZero() || time.Since(c.checked) >= prometheusCheckInterval {
+		c.err = c.check()
+		c.checked = time.Now()
+	}
+	return c.err
+}
+
+// healthResponse lists the failed checks, if any
+type healthResponse struct {
+	Status   string            `json:"status"`
+	Failures map[string]string `json:"failures,omitempty"`
+}
+
+// sendHealth answers 200 if no check failed, 503 otherwise
+func sendHealth(w http.ResponseWriter, failures map[string]string) {
+	response := healthResponse{Status: "ok"}
+	statusCode := http.StatusOK
+	if len(failures) > 0 {
+		response = healthResponse{Status: "failed", Failures: failures}
+		statusCode = http.StatusServiceUnavailable
+
+		names := make([]string, 0, len(failures))
+		for name := range failures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		slog.Debug(fmt.Sprintf("health checks failed: %v", names))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error(fmt.Sprintf("failed to encode health response: %v", err))
+	}
+}
+
+// livenessHandler fails while a pollster is stuck, so the container is
+// restarted
+func livenessHandler(h *healthTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendHealth(w, h.stuck())
+	}
+}
+
+// readinessHandler fails until every pollster completed a successful
+// collection, and while the Prometheus backend, if configured, is unreachable
+func readinessHandler(h *healthTracker, conf *config.Config) http.HandlerFunc {
+	prometheusCheck := &cachedCheck{check: func() error { return prometheus.CheckReady(conf) }}
+	return func(w http.ResponseWriter, r *http.Request) {
+		failures := h.pending()
+		for name, failure := range h.stuck() {
+			failures[name] = failure
+		}
+		if conf.Prometheus.Address != "" && conf.Prometheus.Port != "" {
+			if err := prometheusCheck.result(); err != nil {
+				failures["prometheus"] = err.Error()
+			}
+		}
+		sendHealth(w, failures)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"metricly/config"
+)
+
+// checkHealth calls a health handler and decodes its response
+func checkHealth(t *testing.T, handler http.HandlerFunc) (int, healthResponse) {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var response healthResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode health response: %v", err)
+	}
+	return recorder.Code, response
+}
+
+func TestReadiness(t *testing.T) {
+	prometheusReady := false
+	prometheusChecks := 0
+	prometheusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prometheusChecks++
+		if r.URL.Path != "/-/ready" || !prometheusReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer prometheusServer.Close()
+	prometheusURL, _ := url.Parse(prometheusServer.URL)
+
+	conf := &config.Config{}
+	conf.Prometheus.Address, conf.Prometheus.Port, _ = net.SplitHostPort(prometheusURL.Host)
+
+	tracker := newHealthTracker()
+	tracker.register("cpu", time.Minute)
+	tracker.register("script/raid_health", time.Hour)
+	handler := readinessHandler(tracker, conf)
+
+	tracker.completed("cpu", nil)
+	tracker.completed("script/raid_health", errors.New("script raid_health exited with 2"))
+	status, response := checkHealth(t, handler)
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready before every first collection, got %d", status)
+	}
+	if failure := response.Failures["pollster/script/raid_health"]; !strings.Contains(failure, "exited with 2") {
+		t.Errorf("expected failed script to be reported, got %v", response.Failures)
+	}
+	if _, exists := response.Failures["prometheus"]; !exists {
+		t.Errorf("expected unready prometheus to be reported, got %v", response.Failures)
+	}
+
+	// the prometheus check is cached
+	tracker.completed("script/raid_health", nil)
+	prometheusReady = true
+	if _, response := checkHealth(t, handler); prometheusChecks != 1 || response.Failures["prometheus"] == "" {
+		t.Errorf("expected cached prometheus failure after %d checks, got %v", prometheusChecks, response.Failures)
+	}
+
+	defer func(interval time.Duration) { prometheusCheckInterval = interval }(prometheusCheckInterval)
+	prometheusCheckInterval = 0
+	if status, response := checkHealth(t, handler); status != http.StatusOK || response.Status != "ok" {
+		t.Errorf("expected ready, got %d %v", status, response)
+	}
+
+	// without a prometheus backend only pollsters are checked
+	prometheusServer.Close()
+	if status, _ := checkHealth(t, readinessHandler(tracker, &config.Config{})); status != http.StatusOK {
+		t.Errorf("expected ready without prometheus configured, got %d", status)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	tracker := newHealthTracker()
+	tracker.register("cpu", time.Minute)
+	tracker.register("disk", time.Minute)
+	handler := livenessHandler(tracker)
+
+	// no collection completed yet, but not stuck either
+	if status, _ := checkHealth(t, handler); status != http.StatusOK {
+		t.Errorf("expected live after registration, got %d", status)
+	}
+
+	// failed collections count as progress
+	tracker.completed("cpu", errors.New("failed to open /proc/stat"))
+	tracker.pollsters["disk"].LastCompleted = time.Now().Add(-(stuckIntervals + 1) * time.Minute)
+	status, response := checkHealth(t, handler)
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("expected stuck pollster to fail liveness, got %d", status)
+	}
+	if _, exists := response.Failures["pollster/disk"]; !exists || len(response.Failures) != 1 {
+		t.Errorf("expected only disk to be stuck, got %v", response.Failures)
+	}
+}
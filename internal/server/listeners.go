@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"metricly/config"
+)
+
+// first file descriptor passed by systemd, see sd_listen_fds(3)
+var listenFdsStart = 3
+
+// activationListeners returns the sockets passed by systemd socket
+// activation, none if the process wasn't socket activated
+func activationListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// not meant for processes started by metricly, e.g. scripts
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := fmt.Sprintf("LISTEN_FD_%d", fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// the listener holds a duplicate of the descriptor
+		file.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("socket %s passed by systemd is not a listening socket: %v", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// unixListener creates a unix socket with the configured mode and owner
+func unixListener(listen config.ListenConfig) (net.Listener, error) {
+	// a socket left by a previous run would make listen fail, other files
+	// are left alone
+	if info, err := os.Lstat(listen.Unix); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", listen.Unix)
+		}
+		if err := os.Remove(listen.Unix); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %v", listen.Unix, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", listen.Unix)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setSocketPermissions(listen); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// setSocketPermissions applies mode, owner and group of a unix socket
+func setSocketPermissions(listen config.ListenConfig) error {
+	if listen.Mode != "" {
+		mode, err := strconv.ParseUint(listen.Mode, 8, 32)
+		if err != nil || mode > 0o777 {
+			return fmt.Errorf("invalid mode %q of %s, must be octal like 0660", listen.Mode, listen.Unix)
+		}
+		if err := os.Chmod(listen.Unix, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	uid, gid := -1, -1
+	if listen.Owner != "" {
+		owner, err := user.Lookup(listen.Owner)
+		if err != nil {
+			if owner, err = user.LookupId(listen.Owner); err != nil {
+				return fmt.Errorf("unknown owner %q of %s", listen.Owner, listen.Unix)
+			}
+		}
+		uid, _ = strconv.Atoi(owner.Uid)
+	}
+	if listen.Group != "" {
+		group, err := user.LookupGroup(listen.Group)
+		if err != nil {
+			if group, err = user.LookupGroupId(listen.Group); err != nil {
+				return fmt.Errorf("unknown group %q of %s", listen.Group, listen.Unix)
+			}
+		}
+		gid, _ = strconv.Atoi(group.Gid)
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Lchown(listen.Unix, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openListeners opens the sockets the server listens on: those passed by
+// systemd if socket activated, else server.listen, else server.address and
+// server.port
+func openListeners(conf *config.Config) ([]net.Listener, error) {
+	listeners, err := activationListeners()
+	if err != nil || len(listeners) > 0 {
+		if len(listeners) > 0 && len(conf.Server.Listen) > 0 {
+			slog.Warn("socket activated, ignoring server.listen")
+		}
+		return listeners, err
+	}
+
+	listens := conf.Server.Listen
+	if len(listens) == 0 {
+		listens = []config.ListenConfig{{Address: net.JoinHostPort(conf.Server.Address, conf.Server.Port)}}
+	}
+
+	for _, listen := range listens {
+		var (
+			listener net.Listener
+			err      error
+		)
+		switch {
+		case listen.Address != "" && listen.Unix != "":
+			err = fmt.Errorf("address and unix are exclusive")
+		case listen.Unix != "":
+			listener, err = unixListener(listen)
+		default:
+			if listen.Mode != "" || listen.Owner != "" || listen.Group != "" {
+				err = fmt.Errorf("mode, owner and group only apply to unix sockets")
+			} else {
+				listener, err = net.Listen("tcp", listen.Address)
+			}
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("failed to listen on %s%s: %v", listen.Address, listen.Unix, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
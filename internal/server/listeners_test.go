@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"metricly/config"
+)
+
+func TestOpenListenersUnix(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "metricly.sock")
+
+	// left by a previous run
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	conf := &config.Config{}
+	conf.Server.Listen = []config.ListenConfig{
+		{Address: "127.0.0.1:0"},
+		{Unix: socket, Mode: "0600", Owner: strconv.Itoa(os.Getuid())},
+	}
+	listeners, err := openListeners(conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer closeListeners(listeners)
+	if len(listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %d", len(listeners))
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Type() != fs.ModeSocket || info.Mode().Perm() != 0600 {
+		t.Errorf("expected socket with mode 0600, got %v %v", info, err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})}
+	go server.Serve(listeners[1])
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}}
+	response, err := client.Get("http://metricly/api/v1/metrics")
+	if err != nil {
+		t.Fatalf("failed to reach the unix socket: %v", err)
+	}
+	response.Body.Close()
+}
+
+func TestOpenListenersInvalid(t *testing.T) {
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(regular, []byte("interval: 10s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, listen := range map[string]config.ListenConfig{
+		"not a socket":  {Unix: regular},
+		"both kinds":    {Address: "127.0.0.1:0", Unix: filepath.Join(dir, "a.sock")},
+		"tcp with mode": {Address: "127.0.0.1:0", Mode: "0660"},
+		"invalid mode":  {Unix: filepath.Join(dir, "b.sock"), Mode: "rw-rw----"},
+		"unknown group": {Unix: filepath.Join(dir, "c.sock"), Group: "no-such-group-metricly"},
+	} {
+		conf := &config.Config{}
+		conf.Server.Listen = []config.ListenConfig{{Address: "127.0.0.1:0"}, listen}
+		if listeners, err := openListeners(conf); err == nil {
+			closeListeners(listeners)
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if content, _ := os.ReadFile(regular); string(content) != "interval: 10s\n" {
+		t.Errorf("expected regular file to be left alone")
+	}
+}
+
+func TestOpenListenersSocketActivation(t *testing.T) {
+	passed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer passed.Close()
+	file, err := passed.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a raw descriptor, closed by activationListeners like those passed by
+	// systemd
+	fd, err := syscall.Dup(int(file.Fd()))
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the descriptor systemd would have passed as fd 3
+	defer func(start int) { listenFdsStart = start }(listenFdsStart)
+	listenFdsStart = fd
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "metricly.socket")
+
+	conf := &config.Config{}
+	conf.Server.Listen = []config.ListenConfig{{Address: "127.0.0.1:0"}}
+	listeners, err := openListeners(conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer closeListeners(listeners)
+
+	if len(listeners) != 1 || listeners[0].Addr().String() != passed.Addr().String() {
+		t.Errorf("expected the passed socket to be used, got %v", listeners)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("expected activation variables to be unset")
+	}
+}
@@ -2,40 +2,169 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"metricly/config"
 	collector "metricly/internal/collector"
+	certfile "metricly/internal/pollster/certfile"
+	container "metricly/internal/pollster/container"
 	cpu "metricly/internal/pollster/cpu"
 	disk "metricly/internal/pollster/disk"
+	filescrape "metricly/internal/pollster/filescrape"
+	kernel "metricly/internal/pollster/kernel"
+	kubernetes "metricly/internal/pollster/kubernetes"
+	logtail "metricly/internal/pollster/logtail"
 	memory "metricly/internal/pollster/memory"
 	network "metricly/internal/pollster/network"
+	probe "metricly/internal/pollster/probe"
+	script "metricly/internal/pollster/script"
+	sysinfo "metricly/internal/pollster/sysinfo"
+	systemd "metricly/internal/pollster/systemd"
+	textfile "metricly/internal/pollster/textfile"
+	thermal "metricly/internal/pollster/thermal"
+	timex "metricly/internal/pollster/timex"
+	"sync"
 	"time"
 )
 
-func StartMetricsCollection(ctx context.Context, interval time.Duration, cc *collector.MetriclyCollector) {
+// Pollsters are the collection goroutines started for a configuration
+type Pollsters struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	health *healthTracker
+}
+
+// reportFunc collects metrics once, returning early once ctx is cancelled
+type reportFunc func(context.Context, *collector.MetriclyCollector) error
+
+// newPollsters returns an empty set of pollsters, cancelled with ctx
+func newPollsters(ctx context.Context) *Pollsters {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Pollsters{ctx: ctx, cancel: cancel, health: newHealthTracker()}
+}
+
+// poll runs reportFunc every interval until the pollsters are stopped. The
+// first collection runs right away so readiness doesn't wait for an interval.
+func (p *Pollsters) poll(cc *collector.MetriclyCollector, name string, interval time.Duration, report reportFunc) {
+	p.health.register(name, interval)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := report(p.ctx, cc)
+			if p.ctx.Err() != nil {
+				// interrupted by Stop
+				return
+			}
+			if err != nil {
+				slog.Warn(fmt.Sprintf("%s collection failed: %v", name, err))
+			}
+			p.health.completed(name, err)
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the pollsters and waits for in-flight collections until ctx
+// is done, so the pollster packages can be registered again
+func (p *Pollsters) Stop(ctx context.Context) error {
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("collections still running: %v", ctx.Err())
+	}
+}
+
+func StartMetricsCollection(ctx context.Context, conf *config.Config, cc *collector.MetriclyCollector) *Pollsters {
 
 	cpu.RegisterCPUMetrics(cc)
+	cpu.RegisterCPUFreqMetrics(cc)
 	network.RegisterNetworkMetrics(cc)
 	memory.RegisterMemoryMetrics(cc)
+	memory.RegisterNumaMetrics(cc)
+	memory.RegisterHugepagesMetrics(cc)
 	disk.RegisterDiskMetrics(cc)
+	thermal.RegisterThermalMetrics(cc)
+	sysinfo.RegisterSysinfoMetrics(cc)
+	timex.RegisterTimexMetrics(cc)
+	kernel.RegisterKernelMetrics(cc)
 
-	// Helper function to periodically execute metric reporting
-	startPolling := func(reportFunc func(*collector.MetriclyCollector)) {
-		go func() {
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					reportFunc(cc)
-				}
-			}
-		}()
+	pollsters := newPollsters(ctx)
+	startPolling := func(name string, interval time.Duration, report reportFunc) {
+		pollsters.poll(cc, name, interval, report)
+	}
+
+	// Start collectors for CPU, memory, network, disk, thermal, system info, time sync and kernel metrics
+	startPolling("cpu", conf.CollectionInterval, cpu.ReportCpuUsage)
+	startPolling("cpu_freq", conf.CollectionInterval, cpu.ReportCPUFreq)
+	startPolling("memory", conf.CollectionInterval, memory.ReportMemoryUsage)
+	startPolling("numa", conf.CollectionInterval, memory.ReportNumaUsage)
+	startPolling("hugepages", conf.CollectionInterval, memory.ReportHugepagesUsage)
+	startPolling("network", conf.CollectionInterval, network.ReportNetworkUsage)
+	startPolling("disk", conf.CollectionInterval, disk.ReportDiskUsage)
+	startPolling("thermal", conf.CollectionInterval, thermal.ReportThermalStats)
+	startPolling("sysinfo", conf.CollectionInterval, sysinfo.ReportSysinfo)
+	startPolling("timex", conf.CollectionInterval, timex.ReportTimexStats)
+	startPolling("kernel", conf.CollectionInterval, kernel.ReportKernelUsage)
+
+	// Optional collectors only run when configured
+	if conf.Collectors.Textfile.Directory != "" {
+		textfile.RegisterTextfileMetrics(cc, conf.Collectors.Textfile.Directory)
+		startPolling("textfile", conf.CollectionInterval, textfile.ReportTextfileMetrics)
+	}
+	if len(conf.Collectors.FileScrape) > 0 {
+		filescrape.RegisterFileScrapeMetrics(cc, conf.Collectors.FileScrape)
+		startPolling("file_scrape", conf.CollectionInterval, filescrape.ReportFileScrape)
+	}
+	if len(conf.Collectors.Logtail.Files) > 0 {
+		logtail.RegisterLogtailMetrics(cc, conf.Collectors.Logtail)
+		startPolling("logtail", conf.CollectionInterval, logtail.ReportLogtail)
+	}
+	if len(conf.Collectors.Certificates.Paths) > 0 {
+		certfile.RegisterCertFileMetrics(cc, conf.Collectors.Certificates)
+		startPolling("certificates", conf.CollectionInterval, certfile.ReportCertFiles)
+	}
+	if systemd.RegisterSystemdMetrics(cc, conf.Collectors.Systemd) {
+		startPolling("systemd", conf.CollectionInterval, systemd.ReportSystemdUnits)
+	}
+	if container.RegisterContainerMetrics(cc, conf.Collectors.Containers) {
+		startPolling("containers", conf.CollectionInterval, container.ReportContainerStats)
+	}
+	if kubernetes.RegisterKubernetesMetrics(cc, conf.Collectors.Kubernetes) {
+		startPolling("kubernetes", conf.CollectionInterval, kubernetes.ReportKubernetesPods)
+	}
+
+	// Scripts run on their own schedule
+	if len(conf.Collectors.Scripts) > 0 {
+		scripts := script.RegisterScriptMetrics(cc, conf.Collectors.Scripts, conf.CollectionInterval)
+		for _, s := range scripts {
+			startPolling("script/"+s.Name, s.Interval, script.ReportScript(s))
+		}
+	}
+
+	// Probes run on their own schedule too
+	if len(conf.Collectors.Probes) > 0 {
+		probes := probe.RegisterProbeMetrics(cc, conf.Collectors.Probes, conf.CollectionInterval)
+		for _, p := range probes {
+			startPolling("probe/"+p.Name, p.Interval, probe.ReportProbe(p))
+		}
 	}
 
-	// Start collectors for CPU, memory, and network metrics
-	startPolling(cpu.ReportCpuUsage)
-	startPolling(memory.ReportMemoryUsage)
-	startPolling(network.ReportNetworkUsage)
-	startPolling(disk.ReportDiskUsage)
+	return pollsters
 }
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "metricly/api/v1"
+	"metricly/config"
+	collector "metricly/internal/collector"
+	logtail "metricly/internal/pollster/logtail"
+)
+
+const (
+	// series of the previous configuration are dropped once pollsters of
+	// the new one completed a collection, or after this long
+	staleSeriesTimeout = time.Minute
+
+	// how often the watcher checks whether it was enabled by a reload
+	watchDisabledInterval = time.Minute
+)
+
+// Reloader applies a re-read config file without restarting: pollsters are
+// restarted with the new configuration and HTTP handlers rebuilt, while the
+// collector keeps the reported series. Listeners and TLS settings need a
+// restart.
+type Reloader struct {
+	mutex      sync.Mutex
+	ctx        context.Context
+	configPath string
+	conf       *config.Config
+	cc         *collector.MetriclyCollector
+	pollsters  *Pollsters
+	// kept across reloads unless server.limits changes, so clients don't
+	// get fresh buckets and slots with every reload
+	limiter v1.Middleware
+	handler atomic.Pointer[http.Handler]
+	stopped bool
+	// cancelled by Stop, so a reload waiting for collections doesn't delay
+	// the shutdown
+	stopping       context.Context
+	cancelStopping context.CancelFunc
+}
+
+// NewReloader takes over pollsters started for conf, loaded from configPath
+func NewReloader(ctx context.Context, configPath string, conf *config.Config, cc *collector.MetriclyCollector, pollsters *Pollsters) (*Reloader, error) {
+	cc.AddMetric("config_last_reload_successful", "1 if the last configuration reload succeeded, 0 otherwise", []string{})
+	cc.AddMetric("config_last_reload_success_timestamp_seconds", "Timestamp of the last successful configuration reload", []string{})
+
+	r := &Reloader{ctx: ctx, configPath: configPath, conf: conf, cc: cc, pollsters: pollsters}
+	r.stopping, r.cancelStopping = context.WithCancel(context.Background())
+	r.limiter = v1.NewQueryLimiter(conf.Server.Limits)
+	handler, err := r.newHandler(conf, pollsters)
+	if err != nil {
+		return nil, err
+	}
+	r.handler.Store(&handler)
+	r.reloaded()
+	return r, nil
+}
+
+// Config returns the configuration applied last
+func (r *Reloader) Config() *config.Config {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.conf
+}
+
+// ServeHTTP serves requests with the handlers of the current configuration
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	(*r.handler.Load()).ServeHTTP(w, req)
+}
+
+// newHandler builds the routes served for a configuration
+func (r *Reloader) newHandler(conf *config.Config, pollsters *Pollsters) (http.Handler, error) {
+	mux := http.NewServeMux()
+	v1.HandleRoutes(mux, conf, r.limiter)
+	if conf.Server.Reload.Endpoint {
+		mux.HandleFunc("/-/reload", reloadHandler(r))
+	}
+
+	apiHandler, err := v1.NewAuthHandler(conf.Server.Auth, mux)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure authentication: %v", err)
+	}
+
+	// health endpoints are left out of authentication for kubelet probes
+	routes := http.NewServeMux()
+	routes.HandleFunc("/healthz", livenessHandler(pollsters.health))
+	routes.HandleFunc("/readyz", readinessHandler(pollsters.health, conf))
+	routes.Handle("/", apiHandler)
+	return routes, nil
+}
+
+// Reload re-reads the config file and applies it, the current configuration
+// is kept if the file is invalid
+func (r *Reloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.reload(); err != nil {
+		slog.Error(fmt.Sprintf("failed to reload configuration: %v", err))
+		r.cc.UpdateMetric("config_last_reload_successful", 0, []string{})
+		return err
+	}
+	r.reloaded()
+	slog.Info("Configuration reloaded")
+	return nil
+}
+
+func (r *Reloader) reload() error {
+	if r.stopped {
+		return fmt.Errorf("shutting down")
+	}
+	start := time.Now()
+
+	path := r.configPath
+	conf, err := config.LoadConfig(&path)
+	if err != nil {
+		return err
+	}
+	if err := validateReload(conf); err != nil {
+		return err
+	}
+	if restartRequired(r.conf, conf) {
+		slog.Warn("server address, listeners and TLS settings changed, restart to apply them")
+	}
+
+	// pollsters share package state with those replacing them, which only
+	// start once collections of the current ones completed. If they don't
+	// within shutdown_timeout, collections stay stopped until a later
+	// reload and /healthz fails meanwhile, so the process gets restarted.
+	ctx, cancel := context.WithTimeout(r.stopping, r.conf.Server.ShutdownTimeout)
+	defer cancel()
+	if err := r.pollsters.Stop(ctx); err != nil {
+		r.pollsters.health.stopFailed(err)
+		return fmt.Errorf("failed to stop pollsters: %v", err)
+	}
+	if len(conf.Collectors.Logtail.Files) == 0 {
+		// save positions and close files which are no longer tailed
+		logtail.Close()
+	}
+	if !reflect.DeepEqual(r.conf.Server.Limits, conf.Server.Limits) {
+		r.limiter = v1.NewQueryLimiter(conf.Server.Limits)
+	}
+	r.pollsters = StartMetricsCollection(r.ctx, conf, r.cc)
+	r.conf = conf
+	setLogLevel(conf.Debug)
+	go dropStaleSeries(r.pollsters, r.cc, start)
+
+	handler, err := r.newHandler(conf, r.pollsters)
+	if err != nil {
+		return err
+	}
+	r.handler.Store(&handler)
+	return nil
+}
+
+// Stop stops pollsters and waits for in-flight collections until ctx is
+// done, then flushes state kept by pollsters, e.g. logtail positions
+func (r *Reloader) Stop(ctx context.Context) error {
+	r.cancelStopping()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stopped = true
+	if err := r.pollsters.Stop(ctx); err != nil {
+		// a collection still running may write the state being flushed
+		return err
+	}
+	logtail.Close()
+	return nil
+}
+
+// reloaded records a successful reload
+func (r *Reloader) reloaded() {
+	r.cc.UpdateMetric("config_last_reload_successful", 1, []string{})
+	r.cc.UpdateMetric("config_last_reload_success_timestamp_seconds", float64(time.Now().Unix()), []string{})
+}
+
+// validateReload refuses configurations which LoadConfig can't check,
+// before pollsters of the current one are stopped
+func validateReload(conf *config.Config) error {
+	if _, err := v1.NewAuthHandler(conf.Server.Auth, http.NotFoundHandler()); err != nil {
+		return fmt.Errorf("failed to configure authentication: %v", err)
+	}
+	return nil
+}
+
+// restartRequired tells if settings applied when the server starts changed
+func restartRequired(previous, conf *config.Config) bool {
+	return previous.Server.Address != conf.Server.Address ||
+		previous.Server.Port != conf.Server.Port ||
+		!reflect.DeepEqual(previous.Server.Listen, conf.Server.Listen) ||
+		!reflect.DeepEqual(previous.Server.TLS, conf.Server.TLS)
+}
+
+func setLogLevel(debug bool) {
+	if debug {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	} else {
+		slog.SetLogLoggerLevel(slog.LevelInfo)
+	}
+}
+
+// dropStaleSeries drops series which pollsters didn't report since the
+// reload, e.g. those of disabled collectors or vanished script metrics
+func dropStaleSeries(pollsters *Pollsters, cc *collector.MetriclyCollector, since time.Time) {
+	timeout := time.NewTimer(staleSeriesTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for !pollsters.health.collected() {
+		select {
+		case <-pollsters.ctx.Done():
+			// reloaded again
+			return
+		case <-timeout.C:
+			cc.DropStale(since)
+			return
+		case <-ticker.C:
+		}
+	}
+	cc.DropStale(since)
+}
+
+// watch reloads the configuration when the config file changes, checked
+// every server.reload.watch_interval
+func (r *Reloader) watch(ctx context.Context) {
+	path := config.Path(r.configPath)
+	last, _ := os.Stat(path)
+
+	for {
+		interval := r.Config().Server.Reload.WatchInterval
+		enabled := interval > 0
+		if !enabled {
+			interval = watchDisabledInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("failed to check config file: %v", err))
+			continue
+		}
+		changed := last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size()
+		last = info
+		if enabled && changed {
+			slog.Info(fmt.Sprintf("Config file %s changed, reloading", path))
+			r.Reload()
+		}
+	}
+}
+
+// reloadHandler reloads the configuration on POST /-/reload
+func reloadHandler(r *Reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "only POST or PUT requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		failures := make(map[string]string)
+		if err := r.Reload(); err != nil {
+			failures["config"] = err.Error()
+		}
+		sendHealth(w, failures)
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"metricly/config"
+	collector "metricly/internal/collector"
+	helper "metricly/internal/pollster/tests"
+)
+
+func TestReloader(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("interval: 1h\n")
+
+	conf, err := config.LoadConfig(&path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cc := collector.CreateMetricCollector()
+	reloader, err := NewReloader(ctx, path, conf, cc, StartMetricsCollection(ctx, conf, cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper.VerifyMetric(t, cc, "metricly_config_last_reload_successful", 1)
+
+	// series of the previous configuration are dropped after a reload
+	cc.UpdateMetric("removed_collector", 1, []string{})
+	writeConfig("interval: 1h\nserver:\n  reload:\n    endpoint: true\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if !reloader.Config().Server.Reload.Endpoint {
+		t.Errorf("expected reloaded configuration to be applied")
+	}
+
+	recorder := httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET /-/reload to be refused, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected POST /-/reload to reload, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cc.Mutex.Lock()
+		_, exists := cc.Data["metricly_removed_collector"]
+		cc.Mutex.Unlock()
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected stale series to be dropped")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// an invalid file keeps the current configuration
+	writeConfig("interval: 0s\n")
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("expected zero interval to be refused")
+	}
+	helper.VerifyMetric(t, cc, "metricly_config_last_reload_successful", 0)
+	if !reloader.Config().Server.Reload.Endpoint {
+		t.Errorf("expected previous configuration to be kept")
+	}
+
+	if err := reloader.Stop(context.Background()); err != nil {
+		t.Errorf("unexpected stop error: %v", err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("expected reloads to be refused once stopped")
+	}
+}
+
+func TestReloaderKeepsLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limits := "interval: 1h\nserver:\n  limits:\n    requests_per_second: 0.01\n"
+	writeConfig(limits)
+
+	conf, err := config.LoadConfig(&path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cc := collector.CreateMetricCollector()
+	reloader, err := NewReloader(ctx, path, conf, cc, StartMetricsCollection(ctx, conf, cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Stop(context.Background())
+
+	query := func() int {
+		recorder := httptest.NewRecorder()
+		reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+		return recorder.Code
+	}
+	query()
+	if code := query(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected second query to be rate limited, got %d", code)
+	}
+
+	// unchanged limits keep the client's bucket
+	writeConfig(limits + "  reload:\n    endpoint: true\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if code := query(); code != http.StatusTooManyRequests {
+		t.Errorf("expected rate limit to survive the reload, got %d", code)
+	}
+
+	writeConfig("interval: 1h\nserver:\n  limits:\n    requests_per_second: 100\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if code := query(); code == http.StatusTooManyRequests {
+		t.Errorf("expected changed limits to apply, got %d", code)
+	}
+}
+
+func TestReloaderStopTimeout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	logFile := filepath.Join(dir, "app.log")
+	stateFile := filepath.Join(dir, "logtail.json")
+	if err := os.WriteFile(logFile, []byte("started\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("interval: 1h\nserver:\n  shutdown_timeout: 100ms\n")
+
+	conf, err := config.LoadConfig(&path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cc := collector.CreateMetricCollector()
+	reloader, err := NewReloader(ctx, path, conf, cc, StartMetricsCollection(ctx, conf, cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a collection which doesn't complete fails the reload within
+	// shutdown_timeout
+	blocked := reloader.pollsters
+	blocked.wg.Add(1)
+	start := time.Now()
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("expected reload to fail while a collection is running")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected reload to give up after shutdown_timeout, took %s", time.Since(start))
+	}
+
+	// collections stay stopped, so liveness fails until a reload succeeds
+	recorder := httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "stopped by a reload") {
+		t.Errorf("expected liveness to fail after the stop timed out, got %d %s", recorder.Code, recorder.Body)
+	}
+	blocked.wg.Done()
+	blocked.wg.Wait()
+
+	// a later reload applies the configuration
+	writeConfig(fmt.Sprintf(`interval: 1h
+collectors:
+  logtail:
+    state_file: %s
+    files:
+      - path: %s
+        rules:
+          - name: app_errors
+            regex: error
+`, stateFile, logFile))
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	recorder = httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected liveness to recover with the reload, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	// disabling logtail closes its files with the reload, not the shutdown
+	writeConfig("interval: 1h\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if err := os.Remove(stateFile); err != nil {
+		t.Fatalf("expected logtail state to be saved: %v", err)
+	}
+	if err := reloader.Stop(context.Background()); err != nil {
+		t.Errorf("unexpected stop error: %v", err)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expected closed logtail not to save its state again, got %v", err)
+	}
+}
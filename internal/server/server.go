@@ -6,51 +6,60 @@ import (
 	"fmt"
 	"log/slog"
 	v1 "metricly/api/v1"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
-
-	"metricly/config"
 )
 
-func StartMetriclyServer(ctx context.Context, conf *config.Config) {
-
-	mux := http.NewServeMux()
-	v1.HandleRoutes(mux, conf)
+// StartMetriclyServer serves the routes of the reloader's configuration on
+// every listener, errors of listeners are sent to the returned channel
+func StartMetriclyServer(ctx context.Context, reloader *Reloader) (*http.Server, <-chan error, error) {
 
-	metricsURL := fmt.Sprintf("%s:%s", conf.Server.Address, conf.Server.Port)
+	conf := reloader.Config()
+	handler := v1.Chain(reloader, v1.RequestID, v1.Instrument)
 
 	server := &http.Server{
-		Addr:    metricsURL,
-		Handler: mux,
+		Handler: handler,
 	}
-	slog.Info(fmt.Sprintf("Starting to host metrics on %s ...", metricsURL))
-
-	errChan := make(chan error)
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			errChan <- err
+	useTLS := conf.Server.TLS.CertFile != ""
+	if useTLS {
+		tlsReloader, err := newTLSReloader(conf.Server.TLS)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to configure TLS: %v", err)
 		}
-	}()
+		server.TLSConfig = tlsReloader.serverConfig()
+		go tlsReloader.watch(ctx)
+	} else if len(conf.Server.Auth.Users) > 0 || len(conf.Server.Auth.Tokens) > 0 {
+		slog.Warn("passwords and tokens are sent in cleartext, server.tls should be configured")
+	}
 
-	slog.Info("Started Metricly...")
+	listeners, err := openListeners(conf)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	select {
-	case err := <-errChan:
-		slog.Error(fmt.Sprintf("failed to listen and serve: %v", err))
-	case <-signalChan:
-		slog.Error("Received shutdown signal...")
-
-		// derived ctx from
-		ctx, cancel := context.WithDeadline(ctx, time.Now().Add(5*time.Second))
-		defer cancel()
-		if err := server.Shutdown(ctx); err != nil {
-			slog.Error(fmt.Sprintf("failed to shutdown gracefully: %v", err))
+	errChan := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		if useTLS {
+			slog.Info(fmt.Sprintf("Starting to host metrics over TLS on %s ...", listener.Addr()))
+		} else {
+			slog.Info(fmt.Sprintf("Starting to host metrics on %s ...", listener.Addr()))
 		}
+
+		go func(listener net.Listener) {
+			var err error
+			if useTLS {
+				// certificates are served by server.TLSConfig
+				err = server.ServeTLS(listener, "", "")
+			} else {
+				err = server.Serve(listener)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errChan <- fmt.Errorf("%s: %v", listener.Addr(), err)
+			}
+		}(listener)
 	}
+
+	slog.Info("Started Metricly...")
+	return server, errChan, nil
 }
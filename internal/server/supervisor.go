@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exit codes returned by Run
+const (
+	// stopped by SIGINT or SIGTERM once requests and collections completed
+	ExitOK = 0
+	// failed to start, e.g. invalid config or address already in use
+	ExitFailure = 1
+	// a listener failed while serving
+	ExitServeError = 2
+	// requests or collections didn't complete within shutdown_timeout
+	ExitShutdownTimeout = 3
+)
+
+// Run serves metrics until SIGINT, SIGTERM or a failed listener, reloading
+// the configuration on SIGHUP, then shuts down gracefully and returns the
+// exit code
+func Run(ctx context.Context, reloader *Reloader) int {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signalChan)
+
+	return run(ctx, reloader, signalChan)
+}
+
+// run serves metrics until a signal is received on signalChan
+func run(ctx context.Context, reloader *Reloader, signalChan <-chan os.Signal) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	server, errChan, err := StartMetriclyServer(ctx, reloader)
+	if err != nil {
+		slog.Error(err.Error())
+		shutdown(nil, reloader, signalChan)
+		return ExitFailure
+	}
+	go reloader.watch(ctx)
+
+	code := ExitOK
+wait:
+	for {
+		select {
+		case err := <-errChan:
+			slog.Error(fmt.Sprintf("failed to listen and serve: %v", err))
+			code = ExitServeError
+			break wait
+		case sig := <-signalChan:
+			if sig == syscall.SIGHUP {
+				slog.Info("Received SIGHUP, reloading configuration...")
+				reloader.Reload()
+				continue
+			}
+			slog.Info(fmt.Sprintf("Received %s, shutting down...", sig))
+			break wait
+		}
+	}
+
+	// watchers stop first so nothing reloads while shutting down
+	cancel()
+	if !shutdown(server, reloader, signalChan) && code == ExitOK {
+		code = ExitShutdownTimeout
+	}
+	slog.Info(fmt.Sprintf("Stopped Metricly with exit code %d", code))
+	return code
+}
+
+// shutdown stops accepting requests and waits for in-flight ones, then stops
+// pollsters and waits for in-flight collections, both within the configured
+// shutdown_timeout. A second SIGINT or SIGTERM stops waiting. It returns
+// false if waiting timed out.
+func shutdown(server *http.Server, reloader *Reloader, signalChan <-chan os.Signal) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), reloader.Config().Server.ShutdownTimeout)
+	defer cancel()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signalChan:
+				if sig != syscall.SIGHUP {
+					slog.Warn(fmt.Sprintf("Received %s again, not waiting for requests and collections", sig))
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	completed := true
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error(fmt.Sprintf("failed to complete in-flight requests: %v", err))
+			server.Close()
+			completed = false
+		}
+	}
+	if err := reloader.Stop(ctx); err != nil {
+		slog.Error(fmt.Sprintf("failed to stop pollsters: %v", err))
+		completed = false
+	}
+	return completed
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"metricly/config"
+	collector "metricly/internal/collector"
+)
+
+// newTestReloader returns a reloader serving on a unix socket, whose only
+// pollster runs report
+func newTestReloader(t *testing.T, ctx context.Context, shutdownTimeout string, report reportFunc) *Reloader {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := fmt.Sprintf("server:\n  listen:\n    - unix: %s\n  shutdown_timeout: %s\ninterval: 1h\n", filepath.Join(dir, "metricly.sock"), shutdownTimeout)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.LoadConfig(&path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc := collector.CreateMetricCollector()
+	pollsters := newPollsters(ctx)
+	pollsters.poll(cc, "fake", time.Hour, report)
+	reloader, err := NewReloader(ctx, path, conf, cc, pollsters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reloader
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("HOSTNAME", "testhost")
+
+	// honours cancellation like the pollster packages
+	waiting := func(ctx context.Context, mc *collector.MetriclyCollector) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	tests := []struct {
+		name            string
+		shutdownTimeout string
+		stuck           bool
+		signals         []os.Signal
+		code            int
+	}{
+		{"in-flight collection is cancelled", "10s", false, []os.Signal{syscall.SIGTERM}, ExitOK},
+		{"stuck collection isn't waited for", "200ms", true, []os.Signal{syscall.SIGINT}, ExitShutdownTimeout},
+		{"second signal stops waiting", "1m", true, []os.Signal{syscall.SIGTERM, syscall.SIGTERM}, ExitShutdownTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			report := waiting
+			if test.stuck {
+				release := make(chan struct{})
+				defer close(release)
+				report = func(context.Context, *collector.MetriclyCollector) error {
+					<-release
+					return nil
+				}
+			}
+			reloader := newTestReloader(t, ctx, test.shutdownTimeout, report)
+
+			signalChan := make(chan os.Signal, len(test.signals))
+			for _, sig := range test.signals {
+				signalChan <- sig
+			}
+
+			start := time.Now()
+			if code := run(ctx, reloader, signalChan); code != test.code {
+				t.Errorf("expected exit code %d, got %d", test.code, code)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected shutdown within shutdown_timeout, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestShutdownIgnoresSIGHUP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	reloader := newTestReloader(t, ctx, "10s", func(context.Context, *collector.MetriclyCollector) error {
+		<-release
+		return nil
+	})
+
+	// a reload requested while shutting down neither reloads nor stops
+	// waiting for the collection
+	signalChan := make(chan os.Signal, 1)
+	signalChan <- syscall.SIGHUP
+	done := make(chan bool)
+	go func() { done <- shutdown(nil, reloader, signalChan) }()
+
+	select {
+	case <-done:
+		t.Fatalf("expected shutdown to wait for the collection")
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	if completed := <-done; !completed {
+		t.Errorf("expected shutdown to complete once the collection returned")
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"metricly/config"
+)
+
+// how often certificate files are checked for changes
+var tlsReloadInterval = 10 * time.Second
+
+// tlsReloader serves the certificate and client CA read from files, reloading
+// them once they change so renewed certificates are used without a restart
+type tlsReloader struct {
+	files config.ServerTLSConfig
+	base  *tls.Config
+
+	mutex    sync.RWMutex
+	current  *tls.Config
+	modTimes map[string]time.Time
+}
+
+// parseTLSVersion maps min_version to a crypto/tls version, older versions
+// than 1.2 are refused
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported min_version %q, must be 1.2 or 1.3", version)
+	}
+}
+
+// parseCipherSuites maps cipher suite names to their IDs, suites considered
+// insecure by crypto/tls are refused
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		id, exists := known[name]
+		if !exists {
+			supported := make([]string, 0, len(known))
+			for name := range known {
+				supported = append(supported, name)
+			}
+			sort.Strings(supported)
+			return nil, fmt.Errorf("unsupported cipher suite %q, must be one of %s", name, strings.Join(supported, ", "))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// newTLSReloader validates the TLS settings and loads the certificate and
+// client CA once
+func newTLSReloader(files config.ServerTLSConfig) (*tlsReloader, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, fmt.Errorf("both cert_file and key_file are required")
+	}
+	if files.RequireClientCert && files.ClientCAFile == "" {
+		return nil, fmt.Errorf("require_client_cert needs client_ca_file")
+	}
+
+	minVersion, err := parseTLSVersion(files.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(files.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth := tls.NoClientCert
+	if files.ClientCAFile != "" {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if files.RequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	reloader := &tlsReloader{
+		files: files,
+		base: &tls.Config{
+			MinVersion:   minVersion,
+			CipherSuites: cipherSuites,
+			ClientAuth:   clientAuth,
+			NextProtos:   []string{"h2", "http/1.1"},
+		},
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// paths returns the files watched for changes
+func (r *tlsReloader) paths() []string {
+	paths := []string{r.files.CertFile, r.files.KeyFile}
+	if r.files.ClientCAFile != "" {
+		paths = append(paths, r.files.ClientCAFile)
+	}
+	return paths
+}
+
+// readModTimes stats the watched files, missing ones are left out
+func (r *tlsReloader) readModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range r.paths() {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// load reads the certificate and client CA, and replaces the served config
+// only if both are valid
+func (r *tlsReloader) load() error {
+	modTimes := r.readModTimes()
+
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %v", err)
+	}
+
+	current := r.base.Clone()
+	current.Certificates = []tls.Certificate{cert}
+	if r.files.ClientCAFile != "" {
+		ca, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %v", err)
+		}
+		current.ClientCAs = x509.NewCertPool()
+		if !current.ClientCAs.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate found in client CA %s", r.files.ClientCAFile)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current = current
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed tells if any watched file was modified since the last load
+func (r *tlsReloader) changed() bool {
+	modTimes := r.readModTimes()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(modTimes) != len(r.modTimes) {
+		return true
+	}
+	for path, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the files again if they changed. A failed reload keeps the
+// previous certificate, e.g. while a renewal has written the certificate but
+// not its key yet.
+func (r *tlsReloader) reload() {
+	if !r.changed() {
+		return
+	}
+	if err := r.load(); err != nil {
+		slog.Error(fmt.Sprintf("keeping previous TLS certificate: %v", err))
+		return
+	}
+	slog.Info(fmt.Sprintf("Reloaded TLS certificate from %s", r.files.CertFile))
+}
+
+// watch reloads changed files until ctx is cancelled
+func (r *tlsReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(tlsReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reload()
+		}
+	}
+}
+
+// serverConfig returns the config passed to http.Server, every handshake
+// picks up the latest loaded certificate and client CA
+func (r *tlsReloader) serverConfig() *tls.Config {
+	serverConfig := r.base.Clone()
+	serverConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+		return r.current, nil
+	}
+	// only consulted by older Go releases, which don't accept a config with
+	// GetConfigForClient alone in ListenAndServeTLS
+	serverConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+		return &r.current.Certificates[0], nil
+	}
+	return serverConfig
+}
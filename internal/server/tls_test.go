@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"metricly/config"
+)
+
+// testCert is a certificate along with its key, PEM encoded
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// issueCert signs a certificate for cn with parent, self-signed if nil
+func issueCert(t *testing.T, cn string, serial int64, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeCert writes the certificate and key, with a modification time in the
+// future so changes are noticed regardless of the filesystem resolution
+func writeCert(t *testing.T, dir string, cert *testCert, modTime time.Time) (string, string) {
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	for path, content := range map[string][]byte{certFile: cert.certPEM, keyFile: cert.keyPEM} {
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// serveTLS serves a handler with the reloader config on a random port
+func serveTLS(t *testing.T, reloader *tlsReloader) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+		TLSConfig: reloader.serverConfig(),
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+// servedCert returns the serial of the certificate presented by the server
+func servedCert(t *testing.T, url string, roots *x509.CertPool, clientCert *testCert) (*big.Int, error) {
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		pair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	defer client.CloseIdleConnections()
+
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return response.TLS.PeerCertificates[0].SerialNumber, nil
+}
+
+func TestTLSReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "metricly-ca", 1, true, nil)
+	certFile, keyFile := writeCert(t, dir, issueCert(t, "metricly", 10, false, ca), time.Now())
+
+	reloader, err := newTLSReloader(config.ServerTLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	url := serveTLS(t, reloader)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	if serial, err := servedCert(t, url, roots, nil); err != nil || serial.Int64() != 10 {
+		t.Fatalf("expected certificate 10 to be served, got %v %v", serial, err)
+	}
+
+	// a half written renewal keeps the previous certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	os.Chtimes(keyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	reloader.reload()
+	if serial, err := servedCert(t, url, roots, nil); err != nil || serial.Int64() != 10 {
+		t.Errorf("expected certificate 10 to still be served, got %v %v", serial, err)
+	}
+
+	writeCert(t, dir, issueCert(t, "metricly", 11, false, ca), time.Now().Add(2*time.Minute))
+	reloader.reload()
+	if serial, err := servedCert(t, url, roots, nil); err != nil || serial.Int64() != 11 {
+		t.Errorf("expected renewed certificate 11 to be served, got %v %v", serial, err)
+	}
+}
+
+func TestTLSRequiresClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "metricly-ca", 1, true, nil)
+	certFile, keyFile := writeCert(t, dir, issueCert(t, "metricly", 10, false, ca), time.Now())
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloader, err := newTLSReloader(config.ServerTLSConfig{
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+		MinVersion:        "1.3",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	url := serveTLS(t, reloader)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	if _, err := servedCert(t, url, roots, nil); err == nil {
+		t.Errorf("expected request without client certificate to be rejected")
+	}
+	if _, err := servedCert(t, url, roots, issueCert(t, "intruder", 20, false, nil)); err == nil {
+		t.Errorf("expected client certificate of another CA to be rejected")
+	}
+	if _, err := servedCert(t, url, roots, issueCert(t, "prometheus", 21, false, ca)); err != nil {
+		t.Errorf("expected client certificate signed by the CA to be accepted: %v", err)
+	}
+}
+
+func TestTLSInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, issueCert(t, "metricly", 10, false, nil), time.Now())
+
+	for name, tlsConfig := range map[string]config.ServerTLSConfig{
+		"missing key":        {CertFile: certFile},
+		"client cert, no CA": {CertFile: certFile, KeyFile: keyFile, RequireClientCert: true},
+		"old version":        {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+		"unknown cipher":     {CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"missing client CA":  {CertFile: certFile, KeyFile: keyFile, ClientCAFile: filepath.Join(dir, "missing.crt")},
+		"missing key file":   {CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")},
+	} {
+		if _, err := newTLSReloader(tlsConfig); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := newTLSReloader(config.ServerTLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
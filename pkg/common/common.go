@@ -3,6 +3,7 @@ package common
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // ParseUint safely parses a string to uint64
@@ -12,6 +13,16 @@ func ParseUint(s string) uint64 {
 
 }
 
+// ReadSysfsValue reads a single value file from sysfs or procfs
+// and strips the trailing newline
+func ReadSysfsValue(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
 // hostname needed to append into metrics
 func GetHostname() string {
 
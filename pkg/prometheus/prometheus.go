@@ -3,9 +3,15 @@ package prometheus
 import (
 	"fmt"
 	"metricly/config"
+	"net"
+	"net/http"
 	"net/url"
+	"time"
 )
 
+// readyTimeout bounds readiness checks, which are called by probes
+var readyTimeout = 2 * time.Second
+
 type Query struct {
 	Scheme            string
 	PrometheusAddress string
@@ -42,3 +48,24 @@ func (qb *Query) BuildPrometheusURL(queryParams map[string]string) string {
 	return queryURL.String()
 
 }
+
+// CheckReady tells if Prometheus is reachable and ready to serve queries.
+func CheckReady(config *config.Config) error {
+	readyURL := &url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(config.Prometheus.Address, config.Prometheus.Port),
+		Path:   "/-/ready",
+	}
+
+	client := &http.Client{Timeout: readyTimeout}
+	resp, err := client.Get(readyURL.String())
+	if err != nil {
+		return fmt.Errorf("prometheus is unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("prometheus is not ready: %s", resp.Status)
+	}
+	return nil
+}